@@ -0,0 +1,166 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/spf13/cast"
+)
+
+const (
+	// indexRangeAttribute selects a slice of an array value, e.g. "0:99" or "0:1,2:3" for two dimensions
+	indexRangeAttribute = "indexRange"
+	// arrayTypeAttribute is the OPC UA element type of an array resource, required to write it
+	arrayTypeAttribute = "arrayType"
+)
+
+// arrayTypes maps the names of the OPC UA built-in types to the element types of their arrays. Byte is left
+// out on purpose: the opcua library encodes a []byte as ByteString, not as array of Byte, and decodes an array
+// of Byte into a []byte, which is read like a ByteString.
+var arrayTypes = map[string]reflect.Type{
+	"Boolean": reflect.TypeOf(false),
+	"SByte":   reflect.TypeOf(int8(0)),
+	"Int16":   reflect.TypeOf(int16(0)),
+	"UInt16":  reflect.TypeOf(uint16(0)),
+	"Int32":   reflect.TypeOf(int32(0)),
+	"UInt32":  reflect.TypeOf(uint32(0)),
+	"Int64":   reflect.TypeOf(int64(0)),
+	"UInt64":  reflect.TypeOf(uint64(0)),
+	"Float":   reflect.TypeOf(float32(0)),
+	"Double":  reflect.TypeOf(float64(0)),
+	"String":  reflect.TypeOf(""),
+}
+
+// variantValue returns the value of v. Multi-dimensional arrays are returned as nested slices,
+// also when the library decoded them as one flat slice with ArrayDimensions.
+func variantValue(v *ua.Variant) interface{} {
+	value := v.Value()
+	dims := v.ArrayDimensions()
+	rv := reflect.ValueOf(value)
+	if len(dims) < 2 || rv.Kind() != reflect.Slice || rv.Len() == 0 || rv.Index(0).Kind() == reflect.Slice {
+		return value
+	}
+	size := 1
+	for _, d := range dims {
+		size *= int(d)
+	}
+	if size != rv.Len() {
+		return value
+	}
+	return reshape(rv, dims).Interface()
+}
+
+// reshape splits flat into nested slices of dims, the last dimension varying fastest as OPC UA encodes them.
+func reshape(flat reflect.Value, dims []int32) reflect.Value {
+	if len(dims) == 1 {
+		return flat
+	}
+	n := int(dims[0])
+	step := flat.Len() / n
+	var rows reflect.Value
+	for i := 0; i < n; i++ {
+		row := reshape(flat.Slice(i*step, (i+1)*step), dims[1:])
+		if i == 0 {
+			rows = reflect.MakeSlice(reflect.SliceOf(row.Type()), 0, n)
+		}
+		rows = reflect.Append(rows, row)
+	}
+	return rows
+}
+
+// isArray reports whether reading is an array value. ByteStrings are scalars.
+func isArray(reading interface{}) bool {
+	if _, ok := reading.([]byte); ok {
+		return false
+	}
+	kind := reflect.ValueOf(reading).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// arrayToJSON encodes an array value as JSON string reading.
+func arrayToJSON(reading interface{}) (string, error) {
+	b, err := json.Marshal(reading)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// parseArray decodes a JSON array, possibly nested for multiple dimensions, into slices of the OPC UA
+// built-in type arrayType, ready for ua.NewVariant.
+func parseArray(s string, arrayType string) (interface{}, error) {
+	if arrayType == "Byte" {
+		return nil, fmt.Errorf("unsupported arrayType Byte, the opcua library encodes byte slices as ByteString")
+	}
+	elem, ok := arrayTypes[arrayType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported arrayType %s", arrayType)
+	}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %s", err)
+	}
+	if _, ok := value.([]interface{}); !ok {
+		return nil, fmt.Errorf("invalid JSON array: %s", s)
+	}
+	v, err := convertArray(value, elem)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// convertArray converts a decoded JSON value into elem, or into nested slices of elem for JSON arrays.
+func convertArray(value interface{}, elem reflect.Type) (reflect.Value, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		e, err := convertElement(value, elem)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(e), nil
+	}
+	var typ reflect.Type
+	items := make([]reflect.Value, 0, len(values))
+	for _, v := range values {
+		item, err := convertArray(v, elem)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if typ == nil {
+			typ = item.Type()
+		} else if item.Type() != typ || (item.Kind() == reflect.Slice && item.Len() != items[0].Len()) {
+			return reflect.Value{}, fmt.Errorf("array dimensions don't match")
+		}
+		items = append(items, item)
+	}
+	if typ == nil {
+		typ = elem
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(typ), 0, len(items))
+	return reflect.Append(slice, items...), nil
+}
+
+// convertElement converts one decoded JSON value into an element of elem.
+func convertElement(value interface{}, elem reflect.Type) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		value = n.String()
+	}
+	switch elem.Kind() {
+	case reflect.Bool:
+		return cast.ToBoolE(value)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return convertNumber(value, elem)
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("can't convert %v to %s", value, elem)
+}
@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReshape(t *testing.T) {
+	flat := reflect.ValueOf([]float32{1, 2, 3, 4, 5, 6})
+	expected := [][]float32{{1, 2, 3}, {4, 5, 6}}
+	if v := reshape(flat, []int32{2, 3}).Interface(); !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %v, got %v", expected, v)
+	}
+}
+
+func TestArrayJSON(t *testing.T) {
+	tests := []struct {
+		json      string
+		arrayType string
+		expected  interface{}
+	}{
+		{"[1.5, 2, -3]", "Float", []float32{1.5, 2, -3}},
+		{"[[1, 2], [3, 4]]", "Int16", [][]int16{{1, 2}, {3, 4}}},
+		{"[9007199254740993]", "Int64", []int64{9007199254740993}},
+		{`["a", "b"]`, "String", []string{"a", "b"}},
+		{"[true, false]", "Boolean", []bool{true, false}},
+		{"[]", "Double", []float64{}},
+	}
+	for _, test := range tests {
+		v, err := parseArray(test.json, test.arrayType)
+		if err != nil {
+			t.Errorf("parseArray(%s, %s): %s", test.json, test.arrayType, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("parseArray(%s, %s): expected %#v, got %#v", test.json, test.arrayType, test.expected, v)
+		}
+		if !isArray(v) {
+			t.Errorf("isArray(%#v) is false", v)
+		}
+	}
+
+	for _, invalid := range []string{"1", "[[1, 2], [3]]", "[1, [2]]", `["x"]`} {
+		if _, err := parseArray(invalid, "Int32"); err == nil {
+			t.Errorf("parseArray(%s): expected an error", invalid)
+		}
+	}
+	for _, outOfRange := range []struct{ array, arrayType string }{
+		{"[200]", "SByte"},
+		{"[1, 70000]", "Int16"},
+		{"[-1]", "UInt32"},
+		{"[1e39]", "Float"},
+	} {
+		if v, err := parseArray(outOfRange.array, outOfRange.arrayType); err == nil {
+			t.Errorf("parseArray(%s, %s): expected an out of range error, got %v", outOfRange.array, outOfRange.arrayType, v)
+		}
+	}
+	for _, unsupported := range []string{"Variant", "Byte"} {
+		if _, err := parseArray("[1]", unsupported); err == nil {
+			t.Errorf("expected an error for the unsupported arrayType %s", unsupported)
+		}
+	}
+	if isArray([]byte{1, 2}) {
+		t.Errorf("a ByteString is no array")
+	}
+}
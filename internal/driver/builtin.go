@@ -0,0 +1,219 @@
+package driver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua/ua"
+	"github.com/spf13/cast"
+)
+
+// builtinValue converts a value of an OPC UA built-in type, which has no EdgeX value type, into one newResult
+// can cast to valueType. The mapping is documented in the README. Values of other types are returned unchanged.
+func builtinValue(reading interface{}, valueType sdkModel.ValueType) interface{} {
+	switch v := reading.(type) {
+	case time.Time:
+		if valueType == sdkModel.String {
+			return v.Format(time.RFC3339Nano)
+		}
+		if v.IsZero() {
+			return int64(0)
+		}
+		return v.UnixNano()
+	case []byte:
+		if valueType == sdkModel.String {
+			return base64.StdEncoding.EncodeToString(v)
+		}
+		return v
+	case *ua.GUID:
+		return v.String()
+	case *ua.LocalizedText:
+		return v.Text
+	case *ua.QualifiedName:
+		if v.NamespaceIndex == 0 {
+			return v.Name
+		}
+		return fmt.Sprintf("%d:%s", v.NamespaceIndex, v.Name)
+	case *ua.NodeID:
+		return v.String()
+	case *ua.ExpandedNodeID:
+		return v.String()
+	case ua.StatusCode:
+		if valueType == sdkModel.String {
+			return fmt.Sprintf("%s (0x%08X)", v, uint32(v))
+		}
+		return uint32(v)
+	case ua.XMLElement:
+		return string(v)
+	case *ua.Variant:
+		if v != nil {
+			return builtinValue(v.Value(), valueType)
+		}
+	case *ua.DataValue:
+		if v != nil && v.Value != nil {
+			return builtinValue(v.Value.Value(), valueType)
+		}
+	}
+	return reading
+}
+
+// jsonValue returns the value of v as element of a JSON document of several values, e.g. the fields of an
+// event: built-in types are converted like String readings, structures are decoded into JSON.
+func jsonValue(v *ua.Variant, structures *structureCache) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw := variantValue(v)
+	value, err := structures.decodeValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch raw.(type) {
+	case *ua.ExtensionObject, []*ua.ExtensionObject:
+		return json.RawMessage(value.(string)), nil
+	}
+	return builtinValue(value, sdkModel.String), nil
+}
+
+// convertNumber converts value into the integer or floating point type t. The cast functions of the narrower
+// types wrap values which don't fit, e.g. 70000 into an int16 4464, so value is converted into the widest type
+// of its kind first and fails when it is out of the range of t.
+func convertNumber(value interface{}, t reflect.Type) (interface{}, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if u, ok := value.(uint64); ok && u > math.MaxInt64 {
+			return nil, fmt.Errorf("%v is out of the range of %s", value, t)
+		}
+		i, err := cast.ToInt64E(value)
+		if err != nil {
+			return nil, err
+		}
+		if v.OverflowInt(i) {
+			return nil, fmt.Errorf("%v is out of the range of %s", value, t)
+		}
+		v.SetInt(i)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := cast.ToUint64E(value)
+		if err != nil {
+			return nil, err
+		}
+		if v.OverflowUint(u) {
+			return nil, fmt.Errorf("%v is out of the range of %s", value, t)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := cast.ToFloat64E(value)
+		if err != nil {
+			return nil, err
+		}
+		if v.OverflowFloat(f) {
+			return nil, fmt.Errorf("%v is out of the range of %s", value, t)
+		}
+		v.SetFloat(f)
+	default:
+		return nil, fmt.Errorf("%s is no number type", t)
+	}
+	return v.Interface(), nil
+}
+
+// writeBuiltin converts value, as returned by newCommandValue, into the built-in type of the node to write.
+// Servers refuse values of another type, e.g. an Int32 for an Int16 node. Value is returned unchanged
+// when the type of the node is unknown.
+func writeBuiltin(value interface{}, t ua.TypeID) (interface{}, error) {
+	switch t {
+	case ua.TypeIDBoolean:
+		return cast.ToBoolE(value)
+	case ua.TypeIDSByte:
+		return convertNumber(value, reflect.TypeOf(int8(0)))
+	case ua.TypeIDByte:
+		return convertNumber(value, reflect.TypeOf(uint8(0)))
+	case ua.TypeIDInt16:
+		return convertNumber(value, reflect.TypeOf(int16(0)))
+	case ua.TypeIDUint16:
+		return convertNumber(value, reflect.TypeOf(uint16(0)))
+	case ua.TypeIDInt32:
+		return convertNumber(value, reflect.TypeOf(int32(0)))
+	case ua.TypeIDUint32:
+		return convertNumber(value, reflect.TypeOf(uint32(0)))
+	case ua.TypeIDInt64:
+		return convertNumber(value, reflect.TypeOf(int64(0)))
+	case ua.TypeIDUint64:
+		return convertNumber(value, reflect.TypeOf(uint64(0)))
+	case ua.TypeIDFloat:
+		return convertNumber(value, reflect.TypeOf(float32(0)))
+	case ua.TypeIDDouble:
+		return convertNumber(value, reflect.TypeOf(float64(0)))
+	case ua.TypeIDString:
+		return cast.ToStringE(value)
+	case ua.TypeIDDateTime:
+		if s, ok := value.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+		ns, err := cast.ToInt64E(value)
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(0, ns).UTC(), nil
+	case ua.TypeIDByteString:
+		if s, ok := value.(string); ok {
+			return base64.StdEncoding.DecodeString(s)
+		}
+		if b, ok := value.([]byte); ok {
+			return b, nil
+		}
+	case ua.TypeIDGUID:
+		if s, ok := value.(string); ok {
+			if _, err := parseGUID(s); err != nil {
+				return nil, err
+			}
+			return ua.NewGUID(s), nil
+		}
+	case ua.TypeIDLocalizedText:
+		if s, ok := value.(string); ok {
+			return ua.NewLocalizedText(s), nil
+		}
+	case ua.TypeIDQualifiedName:
+		if s, ok := value.(string); ok {
+			return parseQualifiedName(s)
+		}
+	case ua.TypeIDNodeID:
+		if s, ok := value.(string); ok {
+			return ua.ParseNodeID(s)
+		}
+	case ua.TypeIDExpandedNodeID:
+		if s, ok := value.(string); ok {
+			return ua.ParseExpandedNodeID(s, nil)
+		}
+	case ua.TypeIDStatusCode:
+		code, err := cast.ToUint32E(value)
+		if err != nil {
+			return nil, err
+		}
+		return ua.StatusCode(code), nil
+	case ua.TypeIDXMLElement:
+		if s, ok := value.(string); ok {
+			return ua.XMLElement(s), nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("can't write %v as built-in type %d", value, t)
+}
+
+// parseQualifiedName parses "<namespace index>:<name>", a name without index is in namespace 0.
+func parseQualifiedName(s string) (*ua.QualifiedName, error) {
+	if i := strings.Index(s, ":"); i > 0 {
+		if ns, err := strconv.ParseUint(s[:i], 10, 16); err == nil {
+			return &ua.QualifiedName{NamespaceIndex: uint16(ns), Name: s[i+1:]}, nil
+		}
+	}
+	return &ua.QualifiedName{Name: s}, nil
+}
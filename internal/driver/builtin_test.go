@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestBuiltinValue(t *testing.T) {
+	ts := time.Date(2019, 11, 5, 10, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		reading   interface{}
+		valueType sdkModel.ValueType
+		expected  interface{}
+	}{
+		{ts, sdkModel.Int64, ts.UnixNano()},
+		{ts, sdkModel.String, "2019-11-05T10:30:00.123456789Z"},
+		{time.Time{}, sdkModel.Int64, int64(0)},
+		{[]byte{1, 2, 3}, sdkModel.Binary, []byte{1, 2, 3}},
+		{[]byte{1, 2, 3}, sdkModel.String, "AQID"},
+		{&ua.QualifiedName{Name: "Motor"}, sdkModel.String, "Motor"},
+		{&ua.QualifiedName{NamespaceIndex: 2, Name: "Motor"}, sdkModel.String, "2:Motor"},
+		{&ua.LocalizedText{Text: "Running"}, sdkModel.String, "Running"},
+		{ua.StatusCode(0x80340000), sdkModel.Uint32, uint32(0x80340000)},
+		{ua.XMLElement("<a/>"), sdkModel.String, "<a/>"},
+		{int16(7), sdkModel.Int16, int16(7)},
+	}
+	for _, test := range tests {
+		if v := builtinValue(test.reading, test.valueType); !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("builtinValue(%v, %v): expected %#v, got %#v", test.reading, test.valueType, test.expected, v)
+		}
+	}
+}
+
+func TestWriteBuiltin(t *testing.T) {
+	ts := time.Date(2019, 11, 5, 10, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		value    interface{}
+		typ      ua.TypeID
+		expected interface{}
+	}{
+		{int32(7), ua.TypeIDInt16, int16(7)},
+		{"42", ua.TypeIDUint32, uint32(42)},
+		{float64(1.5), ua.TypeIDFloat, float32(1.5)},
+		{ts.UnixNano(), ua.TypeIDDateTime, ts},
+		{"2019-11-05T10:30:00.123456789Z", ua.TypeIDDateTime, ts},
+		{"AQID", ua.TypeIDByteString, []byte{1, 2, 3}},
+		{"2:Motor", ua.TypeIDQualifiedName, &ua.QualifiedName{NamespaceIndex: 2, Name: "Motor"}},
+		{"Motor:1", ua.TypeIDQualifiedName, &ua.QualifiedName{Name: "Motor:1"}},
+		{"<a/>", ua.TypeIDXMLElement, ua.XMLElement("<a/>")},
+		{int32(7), 0, int32(7)},
+	}
+	for _, test := range tests {
+		v, err := writeBuiltin(test.value, test.typ)
+		if err != nil {
+			t.Errorf("writeBuiltin(%v, %d): %s", test.value, test.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("writeBuiltin(%v, %d): expected %#v, got %#v", test.value, test.typ, test.expected, v)
+		}
+	}
+
+	if _, err := writeBuiltin(int32(7), ua.TypeIDLocalizedText); err == nil {
+		t.Error("writeBuiltin of an Int32 as LocalizedText: expected an error")
+	}
+
+	for _, test := range []struct {
+		value interface{}
+		typ   ua.TypeID
+	}{
+		{int32(70000), ua.TypeIDInt16},
+		{int32(-129), ua.TypeIDSByte},
+		{int64(256), ua.TypeIDByte},
+		{int32(-1), ua.TypeIDUint16},
+		{int32(-1), ua.TypeIDUint64},
+		{"4294967296", ua.TypeIDUint32},
+		{int64(math.MaxInt32 + 1), ua.TypeIDInt32},
+		{uint64(math.MaxUint64), ua.TypeIDInt64},
+		{float64(1e39), ua.TypeIDFloat},
+	} {
+		if v, err := writeBuiltin(test.value, test.typ); err == nil {
+			t.Errorf("writeBuiltin(%v, %d): expected an out of range error, got %v", test.value, test.typ, v)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"fmt"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// callMethods calls methods with as few CallRequests as the MaxNodesPerMethodCall limit of the server allows,
+// 0 means no limit. The results are in the order of methods.
+func callMethods(client *opcua.Client, methods []*ua.CallMethodRequest, maxNodesPerCall uint32) ([]*ua.CallMethodResult, error) {
+	results := make([]*ua.CallMethodResult, 0, len(methods))
+	for _, chunk := range chunkIndexes(len(methods), maxNodesPerCall) {
+		n := chunk[1] - chunk[0]
+		err := client.Send(&ua.CallRequest{MethodsToCall: methods[chunk[0]:chunk[1]]}, func(v interface{}) error {
+			resp, ok := v.(*ua.CallResponse)
+			if !ok {
+				return fmt.Errorf("unexpected response %T", v)
+			}
+			if len(resp.Results) != n {
+				return fmt.Errorf("Call returned %d results for %d methods", len(resp.Results), n)
+			}
+			results = append(results, resp.Results...)
+			return nil
+		})
+		if err != nil {
+			return nil, &serviceError{service: "Call", err: err}
+		}
+	}
+	return results, nil
+}
+
+// callStatus returns the StatusCode of a method call, or of the first input argument the server refused.
+func callStatus(result *ua.CallMethodResult) ua.StatusCode {
+	if result.StatusCode != ua.StatusOK {
+		return result.StatusCode
+	}
+	for _, status := range result.InputArgumentResults {
+		if status != ua.StatusOK {
+			return status
+		}
+	}
+	return ua.StatusOK
+}
@@ -0,0 +1,50 @@
+package driver
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// loadCertificate reads a PEM or DER encoded certificate file and returns the DER bytes.
+func loadCertificate(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%s: unexpected PEM block %s", file, block.Type)
+		}
+		b = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(b); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return b, nil
+}
+
+// loadPrivateKey reads a PEM or DER encoded RSA private key file in PKCS#1 or PKCS#8 format.
+func loadPrivateKey(file string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a PKCS#1 or PKCS#8 private key", file)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not an RSA private key", file, key)
+	}
+	return rsaKey, nil
+}
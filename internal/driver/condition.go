@@ -0,0 +1,168 @@
+package driver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// conditionMethod is a method of the ConditionType and its subtypes a device resource can be mapped to,
+// e.g. {"condition":"Acknowledge"}.
+type conditionMethod struct {
+	methodID uint32
+	event    bool // takes the EventId of the notification and a comment
+	shelving bool // is a method of the ShelvingState of the condition
+}
+
+var conditionMethods = map[string]conditionMethod{
+	"Acknowledge":   {methodID: id.AcknowledgeableConditionType_Acknowledge, event: true},
+	"Confirm":       {methodID: id.AcknowledgeableConditionType_Confirm, event: true},
+	"AddComment":    {methodID: id.ConditionType_AddComment, event: true},
+	"Unshelve":      {methodID: id.ShelvedStateMachineType_Unshelve, shelving: true},
+	"OneShotShelve": {methodID: id.ShelvedStateMachineType_OneShotShelve, shelving: true},
+	"TimedShelve":   {methodID: id.ShelvedStateMachineType_TimedShelve, shelving: true},
+}
+
+// conditionCommand is the parameter of a device resource mapped to a condition method, a JSON object like
+// {"conditionId":"ns=3;s=Tank.Overflow","eventId":"dGVzdA==","comment":"checked"}, whose conditionId and
+// base64 eventId are the ConditionId and EventId fields of the event readings.
+type conditionCommand struct {
+	ConditionID  string `json:"conditionId"`
+	EventID      string `json:"eventId"`
+	Comment      string `json:"comment"`
+	ShelvingTime string `json:"shelvingTime"` // duration like "1h" of TimedShelve
+}
+
+// conditionCall returns the call of the condition method name with the parameter value. The object of
+// shelving methods is the condition, to be replaced by its ShelvingState.
+func conditionCall(name string, value string) (*ua.CallMethodRequest, error) {
+	method, ok := conditionMethods[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown condition method %s", name)
+	}
+	var cmd conditionCommand
+	if err := json.Unmarshal([]byte(value), &cmd); err != nil {
+		return nil, fmt.Errorf("invalid parameter %s: %s", value, err)
+	}
+	if cmd.ConditionID == "" {
+		return nil, fmt.Errorf("invalid parameter %s: no conditionId", value)
+	}
+	conditionID, err := ua.ParseNodeID(cmd.ConditionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conditionId %s: %s", cmd.ConditionID, err)
+	}
+	call := &ua.CallMethodRequest{
+		ObjectID: conditionID,
+		MethodID: ua.NewNumericNodeID(0, method.methodID),
+	}
+	switch {
+	case method.event:
+		if cmd.EventID == "" {
+			return nil, fmt.Errorf("invalid parameter %s: no eventId", value)
+		}
+		eventID, err := base64.StdEncoding.DecodeString(cmd.EventID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid eventId %s: %s", cmd.EventID, err)
+		}
+		call.InputArguments = []*ua.Variant{ua.MustVariant(eventID), ua.MustVariant(ua.NewLocalizedText(cmd.Comment))}
+	case name == "TimedShelve":
+		d, err := time.ParseDuration(cmd.ShelvingTime)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid shelvingTime %s, must be a duration like 1h", cmd.ShelvingTime)
+		}
+		call.InputArguments = []*ua.Variant{ua.MustVariant(float64(d) / float64(time.Millisecond))}
+	}
+	return call, nil
+}
+
+// shelvingState returns the browse path of the ShelvingState of a condition.
+func shelvingState(conditionID *ua.NodeID) *ua.BrowsePath {
+	return &ua.BrowsePath{
+		StartingNode: conditionID,
+		RelativePath: &ua.RelativePath{Elements: []*ua.RelativePathElement{{
+			ReferenceTypeID: ua.NewNumericNodeID(0, id.HasComponent),
+			TargetName:      &ua.QualifiedName{Name: "ShelvingState"},
+		}}},
+	}
+}
+
+// callConditionMethods calls the condition methods of the requests whose device resource is mapped to one, and
+// returns the other requests with their parameters, to be written. A condition method the server refuses fails
+// the command with its StatusCode.
+func callConditionMethods(client *opcua.Client, config *Configuration, nodeMapping map[string]string,
+	reqs []sdkModel.CommandRequest, params []*sdkModel.CommandValue) ([]sdkModel.CommandRequest, []*sdkModel.CommandValue, error) {
+	var writeReqs []sdkModel.CommandRequest
+	var writeParams []*sdkModel.CommandValue
+	var calls []*ua.CallMethodRequest
+	var names, conditions []string
+	var shelving []*ua.BrowsePath
+	var shelvingCalls []*ua.CallMethodRequest
+	for i, req := range reqs {
+		m, err := parseMapping(nodeMapping[req.DeviceResourceName])
+		if err != nil || m.condition == "" {
+			writeReqs = append(writeReqs, req)
+			writeParams = append(writeParams, params[i])
+			continue
+		}
+		value, err := params[i].StringValue()
+		if err != nil {
+			return nil, nil, fmt.Errorf("DeviceResource:%s: %s", req.DeviceResourceName, err)
+		}
+		call, err := conditionCall(m.condition, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("DeviceResource:%s: %s", req.DeviceResourceName, err)
+		}
+		if conditionMethods[m.condition].shelving {
+			shelving = append(shelving, shelvingState(call.ObjectID))
+			shelvingCalls = append(shelvingCalls, call)
+		}
+		calls = append(calls, call)
+		names = append(names, req.DeviceResourceName)
+		conditions = append(conditions, call.ObjectID.String())
+	}
+	if len(calls) == 0 {
+		return writeReqs, writeParams, nil
+	}
+
+	limits := sessions.operationLimits(config)
+	if len(shelving) > 0 {
+		results, err := translateBrowsePaths(client, shelving, limits.maxNodesPerTranslate)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, result := range results {
+			state, err := browsePathTarget(result)
+			if err != nil {
+				return nil, nil, fmt.Errorf("no ShelvingState of condition %s: %s", shelvingCalls[i].ObjectID, err)
+			}
+			shelvingCalls[i].ObjectID = state
+		}
+	}
+
+	results, err := callMethods(client, calls, limits.maxNodesPerCall)
+	if err != nil {
+		return nil, nil, err
+	}
+	callErr := &writeError{service: "Call"}
+	for i, result := range results {
+		if status := callStatus(result); status != ua.StatusOK {
+			callErr.failures = append(callErr.failures, writeFailure{
+				resource: names[i],
+				nodeId:   calls[i].ObjectID.String(), // the ShelvingState for shelving methods
+				status:   status,
+			})
+			continue
+		}
+		driver.Logger.Info(fmt.Sprintf("Called %s on condition %s", names[i], conditions[i]))
+	}
+	if len(callErr.failures) > 0 {
+		return nil, nil, callErr
+	}
+	return writeReqs, writeParams, nil
+}
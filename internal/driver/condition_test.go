@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestConditionCall(t *testing.T) {
+	tests := []struct {
+		method    string
+		value     string
+		arguments int
+	}{
+		{"Acknowledge", `{"conditionId": "ns=3;s=Tank.Overflow", "eventId": "dGVzdA==", "comment": "checked"}`, 2},
+		{"AddComment", `{"conditionId": "ns=3;s=Tank.Overflow", "eventId": "dGVzdA=="}`, 2},
+		{"TimedShelve", `{"conditionId": "ns=3;s=Tank.Overflow", "shelvingTime": "1h"}`, 1},
+		{"Unshelve", `{"conditionId": "ns=3;s=Tank.Overflow"}`, 0},
+	}
+	for _, test := range tests {
+		call, err := conditionCall(test.method, test.value)
+		if err != nil {
+			t.Errorf("%s: %s", test.method, err)
+			continue
+		}
+		if len(call.InputArguments) != test.arguments {
+			t.Errorf("%s: expected %d arguments, got %d", test.method, test.arguments, len(call.InputArguments))
+		}
+	}
+
+	for _, invalid := range []struct{ method, value string }{
+		{"Acknowledge", `{"eventId": "dGVzdA=="}`},
+		{"Acknowledge", `{"conditionId": "ns=3;s=Tank.Overflow"}`},
+		{"Confirm", `{"conditionId": "ns=3;s=Tank.Overflow", "eventId": "not base64!"}`},
+		{"TimedShelve", `{"conditionId": "ns=3;s=Tank.Overflow", "shelvingTime": "soon"}`},
+		{"Disable", `{"conditionId": "ns=3;s=Tank.Overflow"}`},
+		{"Unshelve", `ns=3;s=Tank.Overflow`},
+	} {
+		if _, err := conditionCall(invalid.method, invalid.value); err == nil {
+			t.Errorf("conditionCall(%s, %s): expected an error", invalid.method, invalid.value)
+		}
+	}
+
+	if m, err := parseMapping(`{"condition": "Acknowledge"}`); err != nil || m.condition != "Acknowledge" {
+		t.Errorf("expected the Acknowledge method, got %+v %v", m, err)
+	}
+	if _, err := parseMapping(`{"condition": "Enable"}`); err == nil {
+		t.Error("expected an error for an unknown condition method")
+	}
+}
+
+func TestCallStatus(t *testing.T) {
+	if status := callStatus(&ua.CallMethodResult{InputArgumentResults: []ua.StatusCode{ua.StatusOK}}); status != ua.StatusOK {
+		t.Errorf("expected Good, got 0x%08X", uint32(status))
+	}
+	bad := ua.StatusCode(0x80AB0000)
+	if status := callStatus(&ua.CallMethodResult{InputArgumentResults: []ua.StatusCode{ua.StatusOK, bad}}); status != bad {
+		t.Errorf("expected the refused argument, got 0x%08X", uint32(status))
+	}
+	if status := callStatus(&ua.CallMethodResult{StatusCode: ua.StatusBad}); status != ua.StatusBad {
+		t.Errorf("expected Bad, got 0x%08X", uint32(status))
+	}
+}
@@ -4,6 +4,7 @@ package driver
 import (
 	"fmt"
 	"github.com/edgexfoundry/go-mod-core-contracts/models"
+	"os"
 	"reflect"
 	"strconv"
 )
@@ -12,6 +13,16 @@ const (
 	defaultProtocol = "opc.tcp"
 	defaultPolicy 	= "None"
 	defaultMode   	= "None"
+	defaultEndpointURLRewrite = rewriteConfigured
+	defaultTimestamp = timestampLocal
+	defaultQuality = qualityGood
+	defaultPublishingInterval = "500ms"
+
+	defaultReconnectMinInterval = "1s"
+	defaultReconnectMaxInterval = "2m"
+	defaultReconnectJitter 		= "0.2"
+	defaultPKIDir 				= "./pki"
+	defaultAllowDeprecatedPolicies = "false"
 )
 
 // Configuration can be configured in configuration.toml
@@ -24,6 +35,19 @@ type Configuration struct {
 	Mode  			string		`json:"mode"`
 	CertFile	 	string		`json:"cert_file"`
 	KeyFile 		string		`json:"key_file"`
+	Username		string		`json:"username"`
+	Password		string		`json:"password"`
+	UserCertFile	string		`json:"user_cert_file"`
+	UserKeyFile		string		`json:"user_key_file"`
+	EndpointURLRewrite	string	`json:"endpoint_url_rewrite"`
+	EndpointURLMap	string		`json:"endpoint_url_map"`
+	Timestamp		string		`json:"timestamp"`
+	Quality			string		`json:"quality"`
+	PublishingInterval	string	`json:"publishing_interval"`
+	LifetimeCount	string		`json:"lifetime_count"`
+	MaxKeepAliveCount	string	`json:"max_keep_alive_count"`
+	MaxNotificationsPerPublish	string	`json:"max_notifications_per_publish"`
+	Priority		string		`json:"priority"`
 	MappingStr      string		`json:"mapping_str"`
 }
 
@@ -37,7 +61,66 @@ func (config *Configuration) setDefaultVal()  {
 	if config.Mode == "" {
 		config.Mode = defaultMode
 	}
+	if config.EndpointURLRewrite == "" {
+		config.EndpointURLRewrite = defaultEndpointURLRewrite
+	}
+	if config.Timestamp == "" {
+		config.Timestamp = defaultTimestamp
+	}
+	if config.Quality == "" {
+		config.Quality = defaultQuality
+	}
+	if config.PublishingInterval == "" {
+		config.PublishingInterval = defaultPublishingInterval
+	}
+}
+
+// DriverConfig can be configured in the [Driver] section of configuration.toml
+type DriverConfig struct {
+	ReconnectMinInterval	string	// first delay before reconnecting a broken session, e.g. "1s"
+	ReconnectMaxInterval	string	// upper bound of the exponentially growing delay, e.g. "2m"
+	ReconnectJitter			string	// fraction of the delay randomly added or subtracted, between 0 and 1
+	PKIDir					string	// directory of the own, trusted, issuers and rejected certificates
+	ApplicationURI			string	// ApplicationURI of the driver, written into its generated certificate
+	AllowDeprecatedPolicies	string	// "true" allows the deprecated Basic128Rsa15 and Basic256 policies
 }
+
+func (config *DriverConfig) setDefaultVal() {
+	if config.ReconnectMinInterval == "" {
+		config.ReconnectMinInterval = defaultReconnectMinInterval
+	}
+	if config.ReconnectMaxInterval == "" {
+		config.ReconnectMaxInterval = defaultReconnectMaxInterval
+	}
+	if config.ReconnectJitter == "" {
+		config.ReconnectJitter = defaultReconnectJitter
+	}
+	if config.PKIDir == "" {
+		config.PKIDir = defaultPKIDir
+	}
+	if config.AllowDeprecatedPolicies == "" {
+		config.AllowDeprecatedPolicies = defaultAllowDeprecatedPolicies
+	}
+	if config.ApplicationURI == "" {
+		host, _ := os.Hostname()
+		config.ApplicationURI = fmt.Sprintf("urn:%s:edgex:device-opcua", host)
+	}
+}
+
+// CreateDriverConfig use to load the [Driver] section of configuration.toml
+func CreateDriverConfig(configMap map[string]string) (*DriverConfig, error) {
+	config := new(DriverConfig)
+	if err := load(configMap, config); err != nil {
+		return nil, err
+	}
+	config.setDefaultVal()
+	// parse once to report invalid values at start up
+	if _, err := newBackoff(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 // CreateConfigurationAndMapping use to load connectionInfo for read and write command
 func CreateConfigurationAndMapping(protocols map[string]models.ProtocolProperties) (*Configuration, map[string]string, error) {
 	config := new(Configuration)
@@ -50,6 +133,15 @@ func CreateConfigurationAndMapping(protocols map[string]models.ProtocolPropertie
 		return nil, nil, err
 	}
 	config.setDefaultVal()
+	if err := validTimestampPolicy(config.Timestamp); err != nil {
+		return nil, nil, err
+	}
+	if err := validQualityPolicy(config.Quality); err != nil {
+		return nil, nil, err
+	}
+	if _, err := subscriptionParameters(config); err != nil {
+		return nil, nil, err
+	}
 
 	mapping, err := createNodeMapping(config.MappingStr)
 	if err != nil {
@@ -1,7 +1,6 @@
 package driver
 
 import (
-	"fmt"
 	"testing"
 
 	"github.com/edgexfoundry/go-mod-core-contracts/models"
@@ -11,17 +10,30 @@ func Test(t *testing.T) {
 
 	protocols := map[string]models.ProtocolProperties{
 		Protocol: {
-			Address: "192.168.3.165",
+			Host: "192.168.3.165",
 			Port:  "53530",
 			Path:  "/OPCUA/SimulationServer",
 			Policy:  "None",
 			Mode:  "None",
 			CertFile:  "",
 			KeyFile:  "",
-			MappingStr: "{ \"Counter\" = \"ns=5;s=Counter1\", \"Random\" = \"ns=5;s=Random1\" }",
+			Username: "operator",
+			Password: "secret",
+			MappingStr: "{ \"Counter\": \"ns=5;s=Counter1\", \"Random\": \"ns=5;s=Random1\" }",
 		},
 	}
 
-	q, _ := CreateConnectionInfo(protocols)
-	fmt.Println(q)
+	config, mapping, err := CreateConfigurationAndMapping(protocols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Host != "192.168.3.165" || config.Protocol != defaultProtocol {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+	if config.Username != "operator" || config.Password != "secret" {
+		t.Errorf("user identity not loaded: %+v", config)
+	}
+	if mapping["Counter"] != "ns=5;s=Counter1" {
+		t.Errorf("unexpected mapping %v", mapping)
+	}
 }
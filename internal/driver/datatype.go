@@ -0,0 +1,420 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// defaultBinaryEncoding is the BrowseName of the binary encoding node of a DataType
+const defaultBinaryEncoding = "Default Binary"
+
+// rawStructure is registered for the binary encodings of structures defined by servers, so the opcua
+// library keeps their body for decodeStructure instead of failing on an unknown type.
+type rawStructure struct {
+	body []byte
+}
+
+func (s *rawStructure) Decode(b []byte) (int, error) {
+	s.body = append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (s *rawStructure) Encode() ([]byte, error) {
+	return s.body, nil
+}
+
+// registered holds the encodings rawStructure is registered for, the registry of the opcua
+// library is global and refuses to register an encoding twice.
+var registered = struct {
+	sync.Mutex
+	encodings map[string]bool
+}{encodings: make(map[string]bool)}
+
+func registerEncoding(encodingID *ua.NodeID) {
+	registered.Lock()
+	defer registered.Unlock()
+	if !registered.encodings[encodingID.String()] {
+		ua.RegisterExtensionObject(encodingID, new(rawStructure))
+		registered.encodings[encodingID.String()] = true
+	}
+}
+
+// structureCache holds the DataTypes of the nodes of a server, resolved once per session.
+type structureCache struct {
+	mu           sync.Mutex
+	nodes        map[string]*nodeType             // DataType of a node, nil if it has none
+	types        map[string]*fieldType            // resolved DataTypes
+	encodings    map[string]*structure            // structures by their binary encoding
+	dictionaries map[string]map[string]*structure // parsed DataTypeDictionaries
+}
+
+// nodeType is the DataType of a node: the built-in type its values are sent as, and for structures
+// defined by the server, the structure with the binary encoding its values are sent in.
+type nodeType struct {
+	builtin    ua.TypeID
+	structure  *structure
+	encodingID *ua.NodeID
+}
+
+func newStructureCache() *structureCache {
+	return &structureCache{
+		nodes:        make(map[string]*nodeType),
+		types:        make(map[string]*fieldType),
+		encodings:    make(map[string]*structure),
+		dictionaries: make(map[string]map[string]*structure),
+	}
+}
+
+// prepare resolves the DataTypes of nodes not seen before, so their values can be converted.
+// Failures are logged and retried at the next call, values of those nodes can't be converted until then.
+func (c *structureCache) prepare(client *opcua.Client, nodes []*ua.NodeID, maxNodesPerRead uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unknown []*ua.ReadValueID
+	for _, node := range nodes {
+		if _, ok := c.nodes[node.String()]; !ok {
+			unknown = append(unknown, &ua.ReadValueID{NodeID: node, AttributeID: ua.AttributeIDDataType})
+		}
+	}
+	if len(unknown) == 0 {
+		return
+	}
+	results, err := readNodes(client, unknown, maxNodesPerRead)
+	if err != nil {
+		driver.Logger.Warn(fmt.Sprintf("failed to read DataTypes: %s", err))
+		return
+	}
+	for i, result := range results {
+		node := unknown[i].NodeID
+		if result.Status != ua.StatusOK || result.Value == nil {
+			c.nodes[node.String()] = nil // e.g. an Object, which has no DataType
+			continue
+		}
+		dataType, ok := result.Value.Value().(*ua.NodeID)
+		if !ok {
+			c.nodes[node.String()] = nil
+			continue
+		}
+		nt, err := c.nodeType(client, dataType)
+		if err != nil {
+			driver.Logger.Warn(fmt.Sprintf("failed to resolve DataType %s of node %s: %s", dataType, node, err))
+			continue
+		}
+		c.nodes[node.String()] = nt
+	}
+}
+
+// nodeType resolves dataType and registers the encoding of structures defined by the server.
+// Caller must hold c.mu.
+func (c *structureCache) nodeType(client *opcua.Client, dataType *ua.NodeID) (*nodeType, error) {
+	t, err := c.fieldType(client, dataType)
+	if err != nil {
+		return nil, err
+	}
+	if t.structure == nil {
+		return &nodeType{builtin: t.builtin}, nil
+	}
+	if dataType.Namespace() == 0 {
+		// standard structures are decoded by the opcua library itself
+		return &nodeType{builtin: ua.TypeIDExtensionObject}, nil
+	}
+	encodingID, err := binaryEncoding(client, dataType)
+	if err != nil {
+		return nil, err
+	}
+	registerEncoding(encodingID)
+	c.encodings[encodingID.String()] = t.structure
+	return &nodeType{builtin: ua.TypeIDExtensionObject, structure: t.structure, encodingID: encodingID}, nil
+}
+
+// argumentType resolves the DataType of a method argument like those of nodes, nil if it can't be resolved.
+func (c *structureCache) argumentType(client *opcua.Client, dataType *ua.NodeID) *nodeType {
+	if c == nil || dataType == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nt, err := c.nodeType(client, dataType)
+	if err != nil {
+		driver.Logger.Warn(fmt.Sprintf("failed to resolve DataType %s of an argument: %s", dataType, err))
+		return nil
+	}
+	return nt
+}
+
+// builtinType returns the built-in type the values of node are sent as, 0 if it isn't known.
+func (c *structureCache) builtinType(node *ua.NodeID) ua.TypeID {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nt := c.nodes[node.String()]; nt != nil {
+		return nt.builtin
+	}
+	return 0
+}
+
+// fieldType resolves dataType from its DataTypeDefinition attribute, or, for servers before OPC UA 1.04,
+// from its supertype and the legacy DataTypeDictionary. Caller must hold c.mu.
+func (c *structureCache) fieldType(client *opcua.Client, dataType *ua.NodeID) (*fieldType, error) {
+	if dataType.Namespace() == 0 {
+		switch n := dataType.IntID(); {
+		case n <= uint32(ua.TypeIDDiagnosticInfo):
+			return &fieldType{builtin: ua.TypeID(n)}, nil
+		case n < id.Enumeration: // the abstract Number, Integer and UInteger are sent as Variant
+			return &fieldType{builtin: ua.TypeIDVariant}, nil
+		case n == id.Enumeration:
+			return &fieldType{builtin: ua.TypeIDInt32}, nil
+		}
+	}
+	if t, ok := c.types[dataType.String()]; ok {
+		return t, nil
+	}
+	t := &fieldType{}
+	c.types[dataType.String()] = t // before resolving the fields, structures may refer to themselves
+
+	def, err := readDefinition(client, dataType)
+	if err != nil {
+		delete(c.types, dataType.String())
+		return nil, err
+	}
+	switch d := def.(type) {
+	case *ua.StructureDefinition:
+		t.structure, err = c.definitionStructure(client, dataType, d)
+	case *ua.EnumDefinition:
+		t.builtin = ua.TypeIDInt32
+	default:
+		// no DataTypeDefinition, e.g. a server before OPC UA 1.04
+		var super *ua.NodeID
+		if super, err = supertype(client, dataType); err != nil {
+			break
+		}
+		if super.Namespace() == 0 && super.IntID() == id.Structure {
+			t.structure, err = c.dictionaryStructure(client, dataType)
+			break
+		}
+		var st *fieldType
+		if st, err = c.fieldType(client, super); err == nil {
+			*t = *st
+		}
+	}
+	if err != nil {
+		delete(c.types, dataType.String())
+		return nil, err
+	}
+	return t, nil
+}
+
+func (c *structureCache) definitionStructure(client *opcua.Client, dataType *ua.NodeID, def *ua.StructureDefinition) (*structure, error) {
+	s := &structure{name: dataType.String()}
+	switch def.StructureType {
+	case ua.StructureTypeStructureWithOptionalFields:
+		s.kind = structureOptional
+	case ua.StructureTypeUnion:
+		s.kind = structureUnion
+	}
+	for _, field := range def.Fields {
+		t, err := c.fieldType(client, field.DataType)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", field.Name, err)
+		}
+		if field.ValueRank > 1 {
+			return nil, fmt.Errorf("field %s: multi-dimensional arrays are not supported", field.Name)
+		}
+		s.fields = append(s.fields, &structureField{
+			name:     field.Name,
+			typ:      t,
+			array:    field.ValueRank == 1 || field.ValueRank == 0,
+			optional: field.IsOptional,
+		})
+	}
+	return s, nil
+}
+
+// dictionaryStructure looks dataType up in the DataTypeDictionary holding the description of its binary encoding.
+func (c *structureCache) dictionaryStructure(client *opcua.Client, dataType *ua.NodeID) (*structure, error) {
+	encodingID, err := binaryEncoding(client, dataType)
+	if err != nil {
+		return nil, err
+	}
+	descriptions, err := browseReferences(client, encodingID, id.HasDescription, ua.BrowseDirectionForward)
+	if err != nil || len(descriptions) == 0 {
+		return nil, fmt.Errorf("no DataTypeDescription for encoding %s: %v", encodingID, err)
+	}
+	description := descriptions[0].NodeID.NodeID
+	dictionaries, err := browseReferences(client, description, id.HasComponent, ua.BrowseDirectionInverse)
+	if err != nil || len(dictionaries) == 0 {
+		return nil, fmt.Errorf("no DataTypeDictionary for description %s: %v", description, err)
+	}
+	dictionary := dictionaries[0].NodeID.NodeID
+
+	resp, err := client.Read(&ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{
+			{NodeID: description, AttributeID: ua.AttributeIDValue},
+			{NodeID: dictionary, AttributeID: ua.AttributeIDValue},
+		},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+	})
+	if err != nil {
+		return nil, &serviceError{service: "Read", err: err}
+	}
+	if len(resp.Results) != 2 || resp.Results[0].Value == nil || resp.Results[1].Value == nil {
+		return nil, fmt.Errorf("failed to read DataTypeDictionary %s", dictionary)
+	}
+	name, _ := resp.Results[0].Value.Value().(string)
+
+	structures, ok := c.dictionaries[dictionary.String()]
+	if !ok {
+		b, _ := resp.Results[1].Value.Value().([]byte)
+		if structures, err = parseDictionary(b); err != nil {
+			return nil, err
+		}
+		c.dictionaries[dictionary.String()] = structures
+	}
+	s, ok := structures[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in DataTypeDictionary %s", name, dictionary)
+	}
+	return s, nil
+}
+
+// readDefinition returns the DataTypeDefinition of dataType, nil when the server doesn't provide it.
+func readDefinition(client *opcua.Client, dataType *ua.NodeID) (interface{}, error) {
+	resp, err := client.Read(&ua.ReadRequest{
+		NodesToRead:        []*ua.ReadValueID{{NodeID: dataType, AttributeID: ua.AttributeIDDataTypeDefinition}},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+	})
+	if err != nil {
+		return nil, &serviceError{service: "Read", err: err}
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Status != ua.StatusOK || resp.Results[0].Value == nil {
+		return nil, nil
+	}
+	if eo, ok := resp.Results[0].Value.Value().(*ua.ExtensionObject); ok {
+		return eo.Value, nil
+	}
+	return nil, nil
+}
+
+// supertype returns the DataType dataType is derived from.
+func supertype(client *opcua.Client, dataType *ua.NodeID) (*ua.NodeID, error) {
+	refs, err := browseReferences(client, dataType, id.HasSubtype, ua.BrowseDirectionInverse)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("DataType %s has no supertype", dataType)
+	}
+	return refs[0].NodeID.NodeID, nil
+}
+
+// binaryEncoding returns the Default Binary encoding node of dataType.
+func binaryEncoding(client *opcua.Client, dataType *ua.NodeID) (*ua.NodeID, error) {
+	refs, err := browseReferences(client, dataType, id.HasEncoding, ua.BrowseDirectionForward)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.BrowseName != nil && ref.BrowseName.Name == defaultBinaryEncoding {
+			return ref.NodeID.NodeID, nil
+		}
+	}
+	return nil, fmt.Errorf("DataType %s has no binary encoding", dataType)
+}
+
+// browseReferences returns the references of type refType and its subtypes of node.
+func browseReferences(client *opcua.Client, node *ua.NodeID, refType uint32, direction ua.BrowseDirection) ([]*ua.ReferenceDescription, error) {
+	resp, err := client.Browse(&ua.BrowseRequest{
+		NodesToBrowse: []*ua.BrowseDescription{{
+			NodeID:          node,
+			BrowseDirection: direction,
+			ReferenceTypeID: ua.NewNumericNodeID(0, refType),
+			IncludeSubtypes: true,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	})
+	if err != nil {
+		return nil, &serviceError{service: "Browse", err: err}
+	}
+	if len(resp.Results) != 1 {
+		return nil, fmt.Errorf("Browse returned %d results for 1 node", len(resp.Results))
+	}
+	if resp.Results[0].StatusCode != ua.StatusOK {
+		return nil, resp.Results[0].StatusCode
+	}
+	return resp.Results[0].References, nil
+}
+
+// decodeValue converts structured values, also in arrays, into JSON strings. Other values are returned unchanged.
+func (c *structureCache) decodeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case *ua.ExtensionObject:
+		return c.extensionObjectJSON(v)
+	case []*ua.ExtensionObject:
+		values := make([]json.RawMessage, 0, len(v))
+		for _, eo := range v {
+			s, err := c.extensionObjectJSON(eo)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, json.RawMessage(s))
+		}
+		return arrayToJSON(values)
+	}
+	return value, nil
+}
+
+// extensionObjectJSON decodes a structure of the server with its definition, structures known to the
+// opcua library are already decoded.
+func (c *structureCache) extensionObjectJSON(eo *ua.ExtensionObject) (string, error) {
+	if eo == nil || eo.Value == nil {
+		return "null", nil
+	}
+	raw, ok := eo.Value.(*rawStructure)
+	if !ok {
+		b, err := json.Marshal(eo.Value)
+		return string(b), err
+	}
+	var s *structure
+	if c != nil && eo.TypeID != nil {
+		c.mu.Lock()
+		s = c.encodings[eo.TypeID.NodeID.String()]
+		c.mu.Unlock()
+	}
+	if s == nil {
+		return "", fmt.Errorf("unknown structure encoding %v", eo.TypeID)
+	}
+	return decodeStructure(s, raw.body)
+}
+
+// encodeValue encodes a JSON object into an ExtensionObject of the structured DataType of node.
+// It returns nil if the DataType of node isn't a structure.
+func (c *structureCache) encodeValue(node *ua.NodeID, value string) (*ua.ExtensionObject, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.Lock()
+	nt := c.nodes[node.String()]
+	c.mu.Unlock()
+	if nt == nil || nt.structure == nil {
+		return nil, nil
+	}
+	body, err := encodeStructure(nt.structure, value)
+	if err != nil {
+		return nil, err
+	}
+	return &ua.ExtensionObject{
+		EncodingMask: ua.ExtensionObjectBinary,
+		TypeID:       &ua.ExpandedNodeID{NodeID: nt.encodingID},
+		Value:        &rawStructure{body: body},
+	}, nil
+}
@@ -0,0 +1,145 @@
+package driver
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+const (
+	binarySchemaNamespace = "http://opcfoundation.org/BinarySchema/"
+	uaNamespace           = "http://opcfoundation.org/UA/"
+)
+
+// typeDictionary is a legacy DataTypeDictionary in the OPC Binary schema, as provided by servers
+// before OPC UA 1.04, e.g. for the UDTs of an S7-1500.
+type typeDictionary struct {
+	TargetNamespace string               `xml:"TargetNamespace,attr"`
+	Attrs           []xml.Attr           `xml:",any,attr"`
+	Structured      []dictionaryStruct   `xml:"StructuredType"`
+	Enumerated      []dictionaryEnumType `xml:"EnumeratedType"`
+}
+
+type dictionaryStruct struct {
+	Name   string            `xml:"Name,attr"`
+	Fields []dictionaryField `xml:"Field"`
+}
+
+type dictionaryField struct {
+	Name        string `xml:"Name,attr"`
+	TypeName    string `xml:"TypeName,attr"`
+	Length      string `xml:"Length,attr"`
+	LengthField string `xml:"LengthField,attr"`
+	SwitchField string `xml:"SwitchField,attr"`
+	SwitchValue string `xml:"SwitchValue,attr"`
+}
+
+type dictionaryEnumType struct {
+	Name string `xml:"Name,attr"`
+}
+
+// dictionaryTypes maps the types of the OPC Binary and the OPC UA namespace to built-in types
+var dictionaryTypes = map[string]ua.TypeID{
+	"Boolean":         ua.TypeIDBoolean,
+	"SByte":           ua.TypeIDSByte,
+	"Byte":            ua.TypeIDByte,
+	"Int16":           ua.TypeIDInt16,
+	"UInt16":          ua.TypeIDUint16,
+	"Int32":           ua.TypeIDInt32,
+	"UInt32":          ua.TypeIDUint32,
+	"Int64":           ua.TypeIDInt64,
+	"UInt64":          ua.TypeIDUint64,
+	"Float":           ua.TypeIDFloat,
+	"Double":          ua.TypeIDDouble,
+	"String":          ua.TypeIDString,
+	"CharArray":       ua.TypeIDString,
+	"DateTime":        ua.TypeIDDateTime,
+	"Guid":            ua.TypeIDGUID,
+	"ByteString":      ua.TypeIDByteString,
+	"XmlElement":      ua.TypeIDXMLElement,
+	"NodeId":          ua.TypeIDNodeID,
+	"ExpandedNodeId":  ua.TypeIDExpandedNodeID,
+	"StatusCode":      ua.TypeIDStatusCode,
+	"QualifiedName":   ua.TypeIDQualifiedName,
+	"LocalizedText":   ua.TypeIDLocalizedText,
+	"ExtensionObject": ua.TypeIDExtensionObject,
+	"DataValue":       ua.TypeIDDataValue,
+	"Variant":         ua.TypeIDVariant,
+	"DiagnosticInfo":  ua.TypeIDDiagnosticInfo,
+}
+
+// parseDictionary returns the structures of a DataTypeDictionary by name.
+func parseDictionary(b []byte) (map[string]*structure, error) {
+	var dict typeDictionary
+	if err := xml.Unmarshal(b, &dict); err != nil {
+		return nil, fmt.Errorf("invalid DataTypeDictionary: %s", err)
+	}
+	prefixes := make(map[string]string) // prefix to namespace
+	for _, attr := range dict.Attrs {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Name.Local] = attr.Value
+		}
+	}
+
+	structures := make(map[string]*structure, len(dict.Structured))
+	for _, st := range dict.Structured {
+		structures[st.Name] = &structure{name: st.Name}
+	}
+	enums := make(map[string]bool, len(dict.Enumerated))
+	for _, et := range dict.Enumerated {
+		enums[et.Name] = true
+	}
+
+	for _, st := range dict.Structured {
+		s := structures[st.Name]
+		for _, df := range st.Fields {
+			f := &structureField{
+				name:        df.Name,
+				lengthField: df.LengthField,
+				switchField: df.SwitchField,
+			}
+			if df.SwitchValue != "" {
+				v, err := strconv.ParseInt(df.SwitchValue, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: invalid SwitchValue %s", st.Name, df.Name, df.SwitchValue)
+				}
+				f.switchValue = &v
+			}
+
+			prefix, name := "", df.TypeName
+			if i := strings.Index(name, ":"); i >= 0 {
+				prefix, name = name[:i], name[i+1:]
+			}
+			namespace := prefixes[prefix]
+			switch {
+			case namespace == binarySchemaNamespace && name == "Bit":
+				f.bits = 1
+				if df.Length != "" {
+					n, err := strconv.Atoi(df.Length)
+					if err != nil || n <= 0 {
+						return nil, fmt.Errorf("%s.%s: invalid Length %s", st.Name, df.Name, df.Length)
+					}
+					f.bits = n
+				}
+			case namespace == binarySchemaNamespace || namespace == uaNamespace:
+				t, ok := dictionaryTypes[name]
+				if !ok {
+					return nil, fmt.Errorf("%s.%s: unsupported type %s", st.Name, df.Name, df.TypeName)
+				}
+				f.typ = &fieldType{builtin: t}
+			case namespace == dict.TargetNamespace && structures[name] != nil:
+				f.typ = &fieldType{structure: structures[name]}
+			case namespace == dict.TargetNamespace && enums[name]:
+				f.typ = &fieldType{builtin: ua.TypeIDInt32}
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown type %s", st.Name, df.Name, df.TypeName)
+			}
+			s.fields = append(s.fields, f)
+		}
+		s.link()
+	}
+	return structures, nil
+}
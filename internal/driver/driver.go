@@ -1,15 +1,18 @@
 package driver
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	sdk "github.com/edgexfoundry/device-sdk-go"
 	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
 	"github.com/edgexfoundry/go-mod-core-contracts/clients/logger"
 	"github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/gopcua/opcua"
 	"github.com/gopcua/opcua/ua"
 	"github.com/spf13/cast"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,11 +24,14 @@ var (
 	cancel  	context.CancelFunc
 	wg  		*sync.WaitGroup
     cmsMap 		map[string]*CMS
+	sessions 	*sessionManager
+	pkiStore 	*pki
 )
 
 type Driver struct {
 	Logger      logger.LoggingClient
 	AsyncCh		chan<- *sdkModel.AsyncValues
+	Config		*DriverConfig
 }
 
 func NewProtocolDriver() sdkModel.ProtocolDriver {
@@ -41,8 +47,21 @@ func (d *Driver) Initialize(lc logger.LoggingClient, asyncCh chan<- *sdkModel.As
 	ctx, cancel = context.WithCancel(context.Background())
 	d.Logger = lc
 	d.AsyncCh = asyncCh
+	config, err := CreateDriverConfig(sdk.DriverConfigs())
+	if err != nil {
+		return fmt.Errorf("failed to load driver config: %s", err)
+	}
+	d.Config = config
+	pkiStore, err = newPKI(config.PKIDir, config.ApplicationURI)
+	if err != nil {
+		return fmt.Errorf("failed to create PKI directory %s: %s", config.PKIDir, err)
+	}
+	if err = pkiStore.ensureOwnCertificate(); err != nil {
+		return fmt.Errorf("failed to create application instance certificate: %s", err)
+	}
 	wg = &sync.WaitGroup{}
 	cmsMap = make(map[string]*CMS)
+	sessions = newSessionManager()
 	loadSubState()
 	return nil
 }
@@ -61,57 +80,150 @@ func (d *Driver) HandleReadCommands(deviceName string, protocols map[string]mode
 		driver.Logger.Error(fmt.Sprintf("error create configuration: %s", err))
 		return nil, err
 	}
-	// create an opcua client and open connection based on config
-	client, err := createClient(config)
+	// get the shared opcua client of the device, open connection at first use
+	client, err := sessions.get(deviceName, config)
 	if err != nil {
 		driver.Logger.Error(fmt.Sprintf("Failed to create OPCUA client: %s", err))
 		return nil, err
 	}
-	defer client.Close()
 
-	responses := make([]*sdkModel.CommandValue, len(reqs))
+	// resolve the nodes of all requests to read them at once, indexes[i] is the request of nodes[i]
+	names := make([]string, len(reqs))
 	for i, req := range reqs {
-		nodeId, ok := nodeMapping[req.DeviceResourceName]
-		if !ok {
-			driver.Logger.Error(fmt.Sprintf("No NodeId found by DeviceResource:%s", req.DeviceResourceName))
+		names[i] = req.DeviceResourceName
+	}
+	resolved, errs := resolveNodes(client, config, nodeMapping, names)
+	nodes := make([]*ua.ReadValueID, 0, len(reqs))
+	indexes := make([]int, 0, len(reqs))
+	var methodReqs []sdkModel.CommandRequest // resources mapped to a method return its last outputs, see readMethods
+	var methodNodes []*resolvedNode
+	var methodIndexes []int
+	for i, req := range reqs {
+		if errs[i] != nil {
+			driver.Logger.Error(fmt.Sprintf("Invalid node of DeviceResource:%s: %s", req.DeviceResourceName, errs[i]))
+			continue
+		}
+		if resolved[i].method != nil {
+			methodReqs = append(methodReqs, req)
+			methodNodes = append(methodNodes, resolved[i])
+			methodIndexes = append(methodIndexes, i)
+			continue
+		}
+		nodes = append(nodes, &ua.ReadValueID{
+			NodeID:      resolved[i].id,
+			AttributeID: resolved[i].attribute,
+			IndexRange:  req.Attributes[indexRangeAttribute],
+		})
+		indexes = append(indexes, i)
+	}
+
+	limits := sessions.operationLimits(config)
+	structures := sessions.structures(config)
+	ids := make([]*ua.NodeID, 0, len(nodes))
+	for _, node := range nodes {
+		if node.AttributeID == ua.AttributeIDValue {
+			ids = append(ids, node.NodeID)
+		}
+	}
+	structures.prepare(client, ids, limits.maxNodesPerRead)
+
+	results, err := readNodes(client, nodes, limits.maxNodesPerRead)
+	if err != nil {
+		driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %v", err))
+		if se, ok := err.(*serviceError); ok && se.broken() {
+			// reconnect at next command
+			sessions.invalidate(config, client)
+		}
+		return nil, err
+	}
+
+	responses := make([]*sdkModel.CommandValue, len(reqs))
+	var qualities []*sdkModel.CommandValue // companion quality readings follow the requested ones
+	for i, result := range results {
+		req := reqs[indexes[i]]
+		resTime := origin(result, timestampPolicy(config, req.Attributes))
+		if q := qualityReading(deviceName, req.DeviceResourceName, result.Status, resTime); q != nil {
+			qualities = append(qualities, q)
+		}
+		res, err := d.handleReadCommandRequest(req, result, resTime, qualityPolicy(config, req.Attributes), structures)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %s %v", req.DeviceResourceName, err))
 			continue
 		}
-		res, err := d.handleReadCommandRequest(client, req, nodeId)
+		responses[indexes[i]] = res
+	}
+	if len(methodReqs) > 0 {
+		outputs, err := readMethods(client, deviceName, config, nodeMapping, methodReqs, methodNodes)
 		if err != nil {
 			driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %v", err))
-			continue
+			if se, ok := err.(*serviceError); ok && se.broken() {
+				sessions.invalidate(config, client)
+			}
+			return nil, err
+		}
+		for j, i := range methodIndexes {
+			responses[i] = outputs[j]
 		}
-		responses[i] = res
 	}
-	return responses, nil
+	return append(responses, qualities...), nil
 }
 
-func (d *Driver) handleReadCommandRequest(deviceClient *opcua.Client, req sdkModel.CommandRequest, nodeId string) (*sdkModel.CommandValue, error) {
-	// get NewNodeID
-	id, err := ua.ParseNodeID(nodeId)
-	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("Invalid node id=%s", nodeId))
+// readNodes reads nodes with as few ReadRequests as the MaxNodesPerRead limit of the server allows,
+// 0 means no limit. The results are in the order of nodes.
+func readNodes(deviceClient *opcua.Client, nodes []*ua.ReadValueID, maxNodesPerRead uint32) ([]*ua.DataValue, error) {
+	results := make([]*ua.DataValue, 0, len(nodes))
+	for _, chunk := range chunkIndexes(len(nodes), maxNodesPerRead) {
+		request := &ua.ReadRequest{
+			MaxAge:             2000,
+			NodesToRead:        nodes[chunk[0]:chunk[1]],
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+		}
+		resp, err := deviceClient.Read(request)
+		if err != nil {
+			return nil, &serviceError{service: "Read", err: err}
+		}
+		if len(resp.Results) != chunk[1]-chunk[0] {
+			return nil, fmt.Errorf("Read returned %d results for %d nodes", len(resp.Results), chunk[1]-chunk[0])
+		}
+		results = append(results, resp.Results...)
 	}
+	return results, nil
+}
 
-	// make and execute ReadRequest
-	request := &ua.ReadRequest{
-		MaxAge: 2000,
-		NodesToRead: []*ua.ReadValueID{
-			&ua.ReadValueID{NodeID: id},
-		},
-		TimestampsToReturn: ua.TimestampsToReturnBoth,
+// chunkIndexes splits n items into [start, end) ranges of at most max items, 0 means no limit.
+func chunkIndexes(n int, max uint32) [][2]int {
+	size := n
+	if max > 0 && int(max) < n {
+		size = int(max)
 	}
-	resp, err := deviceClient.Read(request)
-	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("Read failed: %s", err))
+	var chunks [][2]int
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		chunks = append(chunks, [2]int{start, end})
+	}
+	return chunks
+}
+
+// handleReadCommandRequest converts the read result of one command request into its CommandValue
+// stamped with resTime, if qualityPolicy accepts its StatusCode. Structured values are decoded into JSON.
+func (d *Driver) handleReadCommandRequest(req sdkModel.CommandRequest, dataValue *ua.DataValue, resTime int64,
+	qualityPolicy string, structures *structureCache) (*sdkModel.CommandValue, error) {
+	if !acceptQuality(dataValue.Status, qualityPolicy) {
+		return nil, fmt.Errorf("%s status %s (0x%08X) rejected", severity(dataValue.Status), dataValue.Status, uint32(dataValue.Status))
 	}
-	if resp.Results[0].Status != ua.StatusOK {
-		return nil, fmt.Errorf(fmt.Sprintf("Status not OK: %v", resp.Results[0].Status))
+	if dataValue.Value == nil {
+		return nil, fmt.Errorf("no value")
 	}
 
 	// make new result
-	reading := resp.Results[0].Value.Value()
-	result, err := newResult(req, reading)
+	reading, err := structures.decodeValue(variantValue(dataValue.Value))
+	if err != nil {
+		return nil, err
+	}
+	result, err := newResult(req, reading, resTime)
 	if err != nil {
 		return nil, err
 	} else {
@@ -142,66 +254,183 @@ func (d *Driver) HandleWriteCommands(deviceName string, protocols map[string]mod
 		go startListening(deviceName, config, nodeMapping, nodes)
 		return nil
 	}
+	if reqs[0].DeviceResourceName == HistoryCommandName {
+		// first parameter is $HistoryCommandName means the command is to read the history of nodes
+		value, err := params[0].StringValue()
+		if err != nil {
+			return err
+		}
+		query, err := parseHistoryQuery(value)
+		if err != nil {
+			return err
+		}
+		var names []string
+		for i, req := range reqs[1:] {
+			if convert2TF(req.Type, params[i+1]) {
+				names = append(names, req.DeviceResourceName)
+			}
+		}
+		client, err := sessions.get(deviceName, config)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Failed to create OPCUA client: %s", err))
+			return err
+		}
+		nodes, err := historyNodes(client, config, nodeMapping, names)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Handle history command failed: %v", err))
+			return err
+		}
+		wg.Add(1)
+		go readHistory(ctx, deviceName, config, client, query, names, nodes)
+		return nil
+	}
 	// usual command
-	// create an opcua client and open connection based on config
-	client, err := createClient(config)
+	// get the shared opcua client of the device, open connection at first use
+	client, err := sessions.get(deviceName, config)
 	if err != nil {
 		driver.Logger.Error(fmt.Sprintf("Failed to create OPCUA client: %s", err))
 		return err
 	}
-	defer client.Close()
 
+	// resources mapped to a method of conditions or of an object call it, the others are written
+	reqs, params, err = callConditionMethods(client, config, nodeMapping, reqs, params)
+	if err == nil {
+		reqs, params, err = callMethodResources(client, deviceName, config, nodeMapping, reqs, params)
+	}
+	if err != nil {
+		driver.Logger.Error(fmt.Sprintf("Handle write commands failed: %v", err))
+		if se, ok := err.(*serviceError); ok && se.broken() {
+			sessions.invalidate(config, client)
+		}
+		return err
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	// resolve the nodes and their DataTypes first, structured ones are written from JSON
+	names := make([]string, len(reqs))
 	for i, req := range reqs {
-		nodeId, ok := nodeMapping[req.DeviceResourceName]
-		if !ok {
-			return fmt.Errorf(fmt.Sprintf("No NodeId found by DeviceResource:%s", req.DeviceResourceName))
+		names[i] = req.DeviceResourceName
+	}
+	resolved, errs := resolveNodes(client, config, nodeMapping, names)
+	ids := make([]*ua.NodeID, len(resolved))
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("Invalid node of DeviceResource:%s: %s", names[i], err)
 		}
-		err := d.handleWriteCommandRequest(client, req, params[i], nodeId)
+		if resolved[i].attribute != ua.AttributeIDValue {
+			return fmt.Errorf("DeviceResource:%s is mapped to a read-only attribute", names[i])
+		}
+		ids[i] = resolved[i].id
+	}
+	limits := sessions.operationLimits(config)
+	structures := sessions.structures(config)
+	structures.prepare(client, ids, limits.maxNodesPerRead)
+
+	// write all values of the command at once
+	nodes := make([]*ua.WriteValue, 0, len(reqs))
+	for i, req := range reqs {
+		node, err := d.handleWriteCommandRequest(req, params[i], ids[i], structures)
 		if err != nil {
-			return fmt.Errorf(fmt.Sprintf("Handle write commands failed: %v", err))
+			return fmt.Errorf(fmt.Sprintf("Handle write commands failed: %s %v", req.DeviceResourceName, err))
 		}
+		nodes = append(nodes, node)
 	}
-	return nil
-}
 
-func (d *Driver) handleWriteCommandRequest(deviceClient *opcua.Client, req sdkModel.CommandRequest,
-	param *sdkModel.CommandValue, nodeId string) error {
-	// get NewNodeID
-	id, err := ua.ParseNodeID(nodeId)
+	results, err := writeNodes(client, nodes, limits.maxNodesPerWrite)
 	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("Invalid node id=%s", nodeId))
+		driver.Logger.Error(fmt.Sprintf("Handle write commands failed: %v", err))
+		if se, ok := err.(*serviceError); ok && se.broken() {
+			sessions.invalidate(config, client)
+		}
+		return err
+	}
+	writeErr := &writeError{service: "Write"}
+	for i, status := range results {
+		if status != ua.StatusOK {
+			writeErr.failures = append(writeErr.failures, writeFailure{
+				resource: reqs[i].DeviceResourceName,
+				nodeId:   ids[i].String(),
+				status:   status,
+			})
+			continue
+		}
+		driver.Logger.Info(fmt.Sprintf("Write value %s %v", reqs[i].DeviceResourceName, params[i]))
 	}
+	if len(writeErr.failures) > 0 {
+		driver.Logger.Error(writeErr.Error())
+		return writeErr
+	}
+	return nil
+}
 
-	value, err := newCommandValue(req.Type, param)
+// handleWriteCommandRequest converts the parameter of one command request into the value to write to its node.
+// Nodes of a structured DataType are written from a JSON object.
+func (d *Driver) handleWriteCommandRequest(req sdkModel.CommandRequest, param *sdkModel.CommandValue,
+	id *ua.NodeID, structures *structureCache) (*ua.WriteValue, error) {
+	value, err := writeValue(req, param, id, structures)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	v, err := ua.NewVariant(value)
 
 	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("Invalid value: %v", err))
-	}
-
-	request := &ua.WriteRequest{
-		NodesToWrite: []*ua.WriteValue{
-			&ua.WriteValue{
-				NodeID:      id,
-				AttributeID: ua.AttributeIDValue,
-				Value: &ua.DataValue{
-					EncodingMask: uint8(13),  // encoding mask
-					Value:        v,
-				},
-			},
+		return nil, fmt.Errorf(fmt.Sprintf("Invalid value: %v", err))
+	}
+
+	return &ua.WriteValue{
+		NodeID:      id,
+		AttributeID: ua.AttributeIDValue,
+		IndexRange:  req.Attributes[indexRangeAttribute],
+		Value: &ua.DataValue{
+			// only the value, servers like the S7-1500 refuse to write timestamps
+			EncodingMask: ua.DataValueValue,
+			Value:        v,
 		},
+	}, nil
+}
+
+// writeNodes writes nodes with as few WriteRequests as the MaxNodesPerWrite limit of the server allows,
+// 0 means no limit. The StatusCodes are in the order of nodes.
+func writeNodes(deviceClient *opcua.Client, nodes []*ua.WriteValue, maxNodesPerWrite uint32) ([]ua.StatusCode, error) {
+	results := make([]ua.StatusCode, 0, len(nodes))
+	for _, chunk := range chunkIndexes(len(nodes), maxNodesPerWrite) {
+		resp, err := deviceClient.Write(&ua.WriteRequest{NodesToWrite: nodes[chunk[0]:chunk[1]]})
+		if err != nil {
+			return nil, &serviceError{service: "Write", err: err}
+		}
+		if len(resp.Results) != chunk[1]-chunk[0] {
+			return nil, fmt.Errorf("Write returned %d results for %d nodes", len(resp.Results), chunk[1]-chunk[0])
+		}
+		results = append(results, resp.Results...)
 	}
+	return results, nil
+}
 
-	resp, err := deviceClient.Write(request)
-	if err != nil {
-		driver.Logger.Error(fmt.Sprintf("Write value %v failed: %s", v, err))
-		return err
+// writeError is returned when the server refused to write some nodes of a command, or to call some methods.
+type writeError struct {
+	service  string // Write by default, or Call
+	failures []writeFailure
+}
+
+// writeFailure is a node the server refused to write, with the StatusCode it returned.
+type writeFailure struct {
+	resource string
+	nodeId   string
+	status   ua.StatusCode
+}
+
+func (e *writeError) Error() string {
+	msgs := make([]string, len(e.failures))
+	for i, f := range e.failures {
+		msgs[i] = fmt.Sprintf("%s (node %s): %s (0x%08X)", f.resource, f.nodeId, f.status.Error(), uint32(f.status))
 	}
-	driver.Logger.Info(fmt.Sprintf("Write value %s %s", req.DeviceResourceName, resp.Results[0]))
-	return nil
+	service := e.service
+	if service == "" {
+		service = "Write"
+	}
+	return fmt.Sprintf("%s failed: %s", service, strings.Join(msgs, "; "))
 }
 
 
@@ -213,6 +442,7 @@ func (d *Driver) Stop(force bool) error {
 	d.Logger.Debug("Driver is doing clean up jobs...")
 	cancel()
 	wg.Wait()
+	sessions.closeAll()
 	return nil
 }
 
@@ -227,36 +457,72 @@ func (d *Driver) AddDevice(deviceName string, protocols map[string]models.Protoc
 // when a Device associated with this Device Service is updated
 func (d *Driver) UpdateDevice(deviceName string, protocols map[string]models.ProtocolProperties, adminState models.AdminState) error {
 	d.Logger.Debug(fmt.Sprintf("Device %s is updated", deviceName))
+	config, _, err := CreateConfigurationAndMapping(protocols)
+	if err != nil {
+		return err
+	}
+	sessions.move(deviceName, config)
 	return nil
 }
 
 // RemoveDevice is a callback function that is invoked
 // when a Device associated with this Device Service is removed
 func (d *Driver) RemoveDevice(deviceName string, protocols map[string]models.ProtocolProperties) error {
-	d.Logger.Debug(fmt.Sprintf("Device %s is updated", deviceName))
+	d.Logger.Debug(fmt.Sprintf("Device %s is removed", deviceName))
+	stopListening(deviceName)
+	forgetOutputs(deviceName)
+	sessions.release(deviceName)
 	return nil
 }
 
-func createClient(config *Configuration) (*opcua.Client, error) {
+func createClient(deviceName string, config *Configuration) (*opcua.Client, error) {
 	endpoint := fmt.Sprintf("%s://%s:%s%s", config.Protocol, config.Host, config.Port, config.Path)
 	endpoints, err := opcua.GetEndpoints(endpoint)
 	if err != nil {
 		return nil, err
 	}
-	ep := opcua.SelectEndpoint(endpoints, config.Policy, ua.MessageSecurityModeFromString(config.Mode))
-	ep.EndpointURL = endpoint // replace
-	if ep == nil {
-		return nil, fmt.Errorf("failed to find suitable endpoint")
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("server %s returned no endpoints", endpoint)
+	}
+	ep, err := selectEndpoint(config, endpoints, driver.Config.AllowDeprecatedPolicies == "true")
+	if err != nil {
+		return nil, err
+	}
+	endpointURL, err := rewriteEndpointURL(config, ep.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := certificateHosts(config, endpointURL)
+	if err != nil {
+		return nil, err
+	}
+	driver.Logger.Info(fmt.Sprintf("device=%s uses endpoint %s (advertised %s) with policy %s, mode %s, security level %d",
+		deviceName, endpointURL, ep.EndpointURL, ep.SecurityPolicyURI, ep.SecurityMode, ep.SecurityLevel))
+	// work on a copy, the endpoint descriptions may be shared by the opcua library
+	selected := *ep
+	ep = &selected
+	ep.EndpointURL = endpointURL
+	if err := pkiStore.validateServerCertificate(ep, hosts...); err != nil {
+		driver.Logger.Error(fmt.Sprintf("rejected server certificate of device=%s: %s", deviceName, err))
+		return nil, err
+	}
+	identity, err := userIdentity(config, ep)
+	if err != nil {
+		return nil, err
 	}
 	opts := []opcua.Option{
-		opcua.SecurityPolicy(config.Policy),
-		opcua.SecurityModeString(config.Mode),
-		opcua.CertificateFile(config.CertFile),
-		opcua.PrivateKeyFile(config.KeyFile),
+		opcua.SecurityPolicy(ep.SecurityPolicyURI),
+		opcua.SecurityMode(ep.SecurityMode),
 		opcua.SessionTimeout(30 * time.Minute),
-		opcua.AuthAnonymous(),
-		opcua.SecurityFromEndpoint(ep, ua.UserTokenTypeAnonymous),
 	}
+	if certFile, keyFile, applicationURI := pkiStore.applicationCertificate(config); certFile != "" {
+		opts = append(opts,
+			opcua.CertificateFile(certFile),
+			opcua.PrivateKeyFile(keyFile),
+			opcua.ApplicationURI(applicationURI),
+		)
+	}
+	opts = append(opts, identity...)
 	client := opcua.NewClient(ep.EndpointURL, opts...)
 	if err := client.Connect(ctx); err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Failed to create OPCUA client, %s", err))
@@ -265,21 +531,49 @@ func createClient(config *Configuration) (*opcua.Client, error) {
 }
 
 
+// createNodeMapping parses the node mappings of the resources of a device. A mapping given as JSON object
+// is kept as its JSON text, see parseMapping.
 func createNodeMapping(mappingStr string) (map[string]string, error) {
-	var mapping map[string]string
+	var raw map[string]json.RawMessage
 	b := []byte(mappingStr)
-	if err := json.Unmarshal(b, &mapping); err != nil {
+	if err := json.Unmarshal(b, &raw); err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Umarshal failed: %s", err))
 	}
+	mapping := make(map[string]string, len(raw))
+	for name, value := range raw {
+		var node string
+		if err := json.Unmarshal(value, &node); err == nil {
+			mapping[name] = node
+			continue
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil || !isObjectMapping(buf.String()) {
+			return nil, fmt.Errorf("invalid mapping of %s: %s", name, value)
+		}
+		if _, err := parseMapping(buf.String()); err != nil {
+			return nil, fmt.Errorf("invalid mapping of %s: %s", name, err)
+		}
+		mapping[name] = buf.String()
+	}
 	return mapping, nil
 }
 
-func newResult(req sdkModel.CommandRequest, reading interface{}) (*sdkModel.CommandValue, error) {
+func newResult(req sdkModel.CommandRequest, reading interface{}, resTime int64) (*sdkModel.CommandValue, error) {
 	var result = &sdkModel.CommandValue{}
 	var err error
-	var resTime = time.Now().UnixNano()
 	castError := "fail to parse %v reading, %v"
 
+	reading = builtinValue(reading, req.Type)
+	if isArray(reading) {
+		// EdgeX has no array value types, arrays are read as JSON strings
+		if req.Type != sdkModel.String {
+			return nil, fmt.Errorf("array reading of %v needs a String resource", req.DeviceResourceName)
+		}
+		if reading, err = arrayToJSON(reading); err != nil {
+			return nil, fmt.Errorf(castError, req.DeviceResourceName, err)
+		}
+	}
+
 	if !checkValueInRange(req.Type, reading) {
 		err = fmt.Errorf("parse reading fail. Reading %v is out of the value type(%v)'s range", reading, req.Type)
 		driver.Logger.Error(err.Error())
@@ -299,6 +593,12 @@ func newResult(req sdkModel.CommandRequest, reading interface{}) (*sdkModel.Comm
 			return nil, fmt.Errorf(castError, req.DeviceResourceName, err)
 		}
 		result = sdkModel.NewStringValue(req.DeviceResourceName, resTime, val)
+	case sdkModel.Binary:
+		val, ok := reading.([]byte)
+		if !ok {
+			return nil, fmt.Errorf(castError, req.DeviceResourceName, fmt.Sprintf("%T isn't a ByteString", reading))
+		}
+		result, err = sdkModel.NewBinaryValue(req.DeviceResourceName, resTime, val)
 	case sdkModel.Uint8:
 		val, err := cast.ToUint8E(reading)
 		if err != nil {
@@ -402,6 +702,32 @@ func convert2TF(valueType sdkModel.ValueType, param *sdkModel.CommandValue) bool
 	return TF
 }
 
+// writeValue converts param into the value to write: a structure of the DataType of the node or an array
+// from a JSON string, or a scalar.
+func writeValue(req sdkModel.CommandRequest, param *sdkModel.CommandValue, id *ua.NodeID, structures *structureCache) (interface{}, error) {
+	if req.Type == sdkModel.String {
+		s, err := param.StringValue()
+		if err != nil {
+			return nil, err
+		}
+		eo, err := structures.encodeValue(id, s)
+		if err != nil {
+			return nil, err
+		}
+		if eo != nil {
+			return eo, nil
+		}
+		if arrayType, ok := req.Attributes[arrayTypeAttribute]; ok {
+			return parseArray(s, arrayType)
+		}
+	}
+	value, err := newCommandValue(req.Type, param)
+	if err != nil {
+		return nil, err
+	}
+	return writeBuiltin(value, structures.builtinType(id))
+}
+
 func newCommandValue(valueType sdkModel.ValueType, param *sdkModel.CommandValue) (interface{}, error) {
 	var commandValue interface{}
 	var err error
@@ -410,6 +736,8 @@ func newCommandValue(valueType sdkModel.ValueType, param *sdkModel.CommandValue)
 		commandValue, err = param.BoolValue()
 	case sdkModel.String:
 		commandValue, err = param.StringValue()
+	case sdkModel.Binary:
+		commandValue, err = param.BinaryValue()
 	case sdkModel.Uint8:
 		commandValue, err = param.Uint8Value()
 	case sdkModel.Uint16:
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkIndexes(t *testing.T) {
+	tests := []struct {
+		n        int
+		max      uint32
+		expected [][2]int
+	}{
+		{0, 0, nil},
+		{5, 0, [][2]int{{0, 5}}},
+		{5, 10, [][2]int{{0, 5}}},
+		{5, 2, [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+		{4, 2, [][2]int{{0, 2}, {2, 4}}},
+	}
+	for _, test := range tests {
+		if chunks := chunkIndexes(test.n, test.max); !reflect.DeepEqual(chunks, test.expected) {
+			t.Errorf("chunkIndexes(%d, %d): expected %v, got %v", test.n, test.max, test.expected, chunks)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	err := &writeError{failures: []writeFailure{
+		{resource: "Counter", nodeId: "ns=5;s=Counter1", status: 0x80740000},
+		{resource: "Random", nodeId: "ns=5;s=Random1", status: 0x801F0000},
+	}}
+	msg := err.Error()
+	for _, s := range []string{"Counter", "ns=5;s=Counter1", "0x80740000", "Random", "ns=5;s=Random1", "0x801F0000"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("%q misses %s", msg, s)
+		}
+	}
+}
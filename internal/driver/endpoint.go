@@ -0,0 +1,153 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// autoSecurity as Policy or Mode selects the best endpoint the server offers.
+const autoSecurity = "auto"
+
+const securityPolicyURIPrefix = "http://opcfoundation.org/UA/SecurityPolicy#"
+
+// policyStrength ranks the security policies supported by the auto selection, higher is stronger.
+var policyStrength = map[string]int{
+	ua.SecurityPolicyURIBasic128Rsa15:       1,
+	ua.SecurityPolicyURIBasic256:            2,
+	ua.SecurityPolicyURIAes128Sha256RsaOaep: 3,
+	ua.SecurityPolicyURIBasic256Sha256:      4,
+	ua.SecurityPolicyURIAes256Sha256RsaPss:  5,
+}
+
+// deprecatedPolicies use SHA-1 and are refused unless AllowDeprecatedPolicies is set.
+var deprecatedPolicies = map[string]bool{
+	ua.SecurityPolicyURIBasic128Rsa15: true,
+	ua.SecurityPolicyURIBasic256:      true,
+}
+
+// selectEndpoint returns the endpoint matching the Policy and Mode of config. When either of them is
+// "auto", the secure endpoints are ranked by their SecurityLevel and the strength of their policy and
+// the best one offering a token policy for the configured user identity is chosen.
+func selectEndpoint(config *Configuration, endpoints []*ua.EndpointDescription, allowDeprecated bool) (*ua.EndpointDescription, error) {
+	autoPolicy := strings.EqualFold(config.Policy, autoSecurity)
+	autoMode := strings.EqualFold(config.Mode, autoSecurity)
+	if !autoPolicy && !autoMode {
+		ep := opcua.SelectEndpoint(endpoints, config.Policy, ua.MessageSecurityModeFromString(config.Mode))
+		if ep == nil {
+			return nil, fmt.Errorf("server offers no endpoint with policy %s and mode %s", config.Policy, config.Mode)
+		}
+		if deprecatedPolicies[ep.SecurityPolicyURI] && !allowDeprecated {
+			return nil, fmt.Errorf("policy %s is deprecated, set AllowDeprecatedPolicies to use it", ep.SecurityPolicyURI)
+		}
+		return ep, nil
+	}
+
+	var best *ua.EndpointDescription
+	for _, ep := range endpoints {
+		if ep == nil {
+			continue
+		}
+		if _, ok := policyStrength[ep.SecurityPolicyURI]; !ok || (deprecatedPolicies[ep.SecurityPolicyURI] && !allowDeprecated) {
+			continue
+		}
+		if !autoPolicy && ep.SecurityPolicyURI != securityPolicyURI(config.Policy) {
+			continue
+		}
+		if ep.SecurityMode != ua.MessageSecurityModeSign && ep.SecurityMode != ua.MessageSecurityModeSignAndEncrypt {
+			continue
+		}
+		if !autoMode && ep.SecurityMode != ua.MessageSecurityModeFromString(config.Mode) {
+			continue
+		}
+		if _, err := selectUserTokenPolicy(ep, userTokenType(config)); err != nil {
+			continue
+		}
+		if best == nil || betterEndpoint(ep, best) {
+			best = ep
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("server offers no secure endpoint with policy %s, mode %s and a %s user token policy",
+			config.Policy, config.Mode, userTokenType(config))
+	}
+	return best, nil
+}
+
+// betterEndpoint reports whether a ranks before b: higher SecurityLevel first, then the stronger policy,
+// then SignAndEncrypt before Sign.
+func betterEndpoint(a, b *ua.EndpointDescription) bool {
+	if a.SecurityLevel != b.SecurityLevel {
+		return a.SecurityLevel > b.SecurityLevel
+	}
+	if policyStrength[a.SecurityPolicyURI] != policyStrength[b.SecurityPolicyURI] {
+		return policyStrength[a.SecurityPolicyURI] > policyStrength[b.SecurityPolicyURI]
+	}
+	return a.SecurityMode > b.SecurityMode
+}
+
+// securityPolicyURI expands a policy name like Basic256Sha256 into its URI.
+func securityPolicyURI(policy string) string {
+	if strings.HasPrefix(policy, securityPolicyURIPrefix) {
+		return policy
+	}
+	return securityPolicyURIPrefix + policy
+}
+
+// rewrite rules of the EndpointURL advertised by a server
+const (
+	rewriteKeep       = "keep"       // connect to the advertised url
+	rewriteConfigured = "configured" // connect to the configured Host, Port and Path
+	rewriteMap        = "map"        // replace host or host:port of the advertised url by EndpointURLMap
+)
+
+// rewriteEndpointURL returns the url to connect to for the url advertised by the server, according to
+// the EndpointURLRewrite rule of config.
+func rewriteEndpointURL(config *Configuration, advertised string) (string, error) {
+	switch config.EndpointURLRewrite {
+	case rewriteKeep:
+		return advertised, nil
+	case rewriteConfigured:
+		return fmt.Sprintf("%s://%s:%s%s", config.Protocol, config.Host, config.Port, config.Path), nil
+	case rewriteMap:
+		var mapping map[string]string
+		if err := json.Unmarshal([]byte(config.EndpointURLMap), &mapping); err != nil {
+			return "", fmt.Errorf("invalid EndpointURLMap: %s", err)
+		}
+		u, err := url.Parse(advertised)
+		if err != nil {
+			return "", fmt.Errorf("server advertises invalid endpoint url %s: %s", advertised, err)
+		}
+		// an entry for host:port wins over one for the host only, which keeps the advertised port
+		if target, ok := mapping[u.Host]; ok {
+			u.Host = target
+		} else if target, ok := mapping[u.Hostname()]; ok {
+			if _, _, err := net.SplitHostPort(target); err != nil && u.Port() != "" {
+				target = net.JoinHostPort(target, u.Port())
+			}
+			u.Host = target
+		}
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("invalid EndpointURLRewrite %s, use %s, %s or %s",
+		config.EndpointURLRewrite, rewriteKeep, rewriteConfigured, rewriteMap)
+}
+
+// certificateHosts returns the hosts the server certificate may be issued for: the host of endpointURL, the url
+// connected to, and with the keep rule also the configured host, since servers behind NAT know only their internal
+// name. The host a rewritten url was advertised with isn't accepted.
+func certificateHosts(config *Configuration, endpointURL string) ([]string, error) {
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint url %s: %s", endpointURL, err)
+	}
+	if config.EndpointURLRewrite == rewriteKeep {
+		return []string{config.Host, u.Hostname()}, nil
+	}
+	return []string{u.Hostname()}, nil
+}
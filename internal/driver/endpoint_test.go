@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestSelectEndpointAuto(t *testing.T) {
+	anonymous := []*ua.UserTokenPolicy{{TokenType: ua.UserTokenTypeAnonymous}}
+	endpoints := []*ua.EndpointDescription{
+		{SecurityPolicyURI: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone, SecurityLevel: 0, UserIdentityTokens: anonymous},
+		{SecurityPolicyURI: ua.SecurityPolicyURIBasic256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt, SecurityLevel: 9, UserIdentityTokens: anonymous},
+		{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSign, SecurityLevel: 5, UserIdentityTokens: anonymous},
+		{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt, SecurityLevel: 5, UserIdentityTokens: anonymous},
+		{SecurityPolicyURI: ua.SecurityPolicyURIAes128Sha256RsaOaep, SecurityMode: ua.MessageSecurityModeSignAndEncrypt, SecurityLevel: 5},
+	}
+	config := &Configuration{Policy: "auto", Mode: "auto"}
+
+	ep, err := selectEndpoint(config, endpoints, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep != endpoints[3] {
+		t.Errorf("expected Basic256Sha256 SignAndEncrypt, got %s %s", ep.SecurityPolicyURI, ep.SecurityMode)
+	}
+
+	ep, err = selectEndpoint(config, endpoints, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep != endpoints[1] {
+		t.Errorf("expected deprecated Basic256 with highest security level, got %s", ep.SecurityPolicyURI)
+	}
+
+	config.Username = "operator"
+	if _, err := selectEndpoint(config, endpoints, false); err == nil {
+		t.Error("endpoint without user name token policy selected")
+	}
+}
+
+func TestRewriteEndpointURL(t *testing.T) {
+	config := &Configuration{
+		Protocol:       "opc.tcp",
+		Host:           "10.0.0.5",
+		Port:           "14840",
+		Path:           "/",
+		EndpointURLMap: `{"plc-1:4840": "gateway:14841", "plc-2": "10.0.0.6"}`,
+	}
+	tests := []struct {
+		rewrite    string
+		advertised string
+		expected   string
+	}{
+		{rewriteKeep, "opc.tcp://plc-1:4840", "opc.tcp://plc-1:4840"},
+		{rewriteConfigured, "opc.tcp://plc-1:4840", "opc.tcp://10.0.0.5:14840/"},
+		{rewriteMap, "opc.tcp://plc-1:4840/path", "opc.tcp://gateway:14841/path"},
+		{rewriteMap, "opc.tcp://plc-2:4840", "opc.tcp://10.0.0.6:4840"},
+		{rewriteMap, "opc.tcp://plc-3:4840", "opc.tcp://plc-3:4840"},
+	}
+	for _, test := range tests {
+		config.EndpointURLRewrite = test.rewrite
+		u, err := rewriteEndpointURL(config, test.advertised)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != test.expected {
+			t.Errorf("%s %s: expected %s, got %s", test.rewrite, test.advertised, test.expected, u)
+		}
+	}
+
+	config.EndpointURLRewrite = "nat"
+	if _, err := rewriteEndpointURL(config, "opc.tcp://plc-1:4840"); err == nil {
+		t.Error("invalid rewrite rule accepted")
+	}
+}
+
+func TestCertificateHosts(t *testing.T) {
+	config := &Configuration{Host: "gateway", EndpointURLRewrite: rewriteKeep}
+	hosts, err := certificateHosts(config, "opc.tcp://plc-internal:4840")
+	if err != nil || !reflect.DeepEqual(hosts, []string{"gateway", "plc-internal"}) {
+		t.Errorf("keep: unexpected hosts %v %v", hosts, err)
+	}
+	config.EndpointURLRewrite = rewriteMap
+	hosts, err = certificateHosts(config, "opc.tcp://plc.example.com:4840")
+	if err != nil || !reflect.DeepEqual(hosts, []string{"plc.example.com"}) {
+		t.Errorf("map: expected only the mapped host, got %v %v", hosts, err)
+	}
+}
@@ -0,0 +1,218 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// conditionIDField selects the NodeId of the condition of an event, which has no browse path.
+const conditionIDField = "ConditionId"
+
+// defaultEventFields are selected from events when the mapping selects none.
+var defaultEventFields = []string{"EventId", "EventType", "SourceName", "Time", "Message", "Severity"}
+
+// eventMapping is the EventFilter of a device resource receiving the events of its node, a notifier like the
+// Server object, e.g. {"node":"i=2253","events":{"select":["EventId","Message","ActiveState/Id"],
+// "where":{"ofType":["i=2915"],"minSeverity":500}}}.
+type eventMapping struct {
+	Select []string    `json:"select"` // browse paths of the fields from the BaseEventType, or ConditionId
+	Where  *eventWhere `json:"where"`
+}
+
+// eventWhere is the where clause of an EventFilter. Events must match all of its conditions.
+type eventWhere struct {
+	OfType      []string `json:"ofType"`      // NodeIds of event types, events of one of them or of their subtypes
+	MinSeverity uint16   `json:"minSeverity"` // lowest Severity, 1 to 1000
+}
+
+// fields returns the names of the fields selected from events.
+func (e *eventMapping) fields() []string {
+	if len(e.Select) == 0 {
+		return defaultEventFields
+	}
+	return e.Select
+}
+
+// filter returns the EventFilter of e.
+func (e *eventMapping) filter() (*ua.EventFilter, error) {
+	// an empty WhereClause selects all events, servers may refuse a filter without one
+	filter := &ua.EventFilter{WhereClause: &ua.ContentFilter{}}
+	for _, field := range e.fields() {
+		operand, err := selectClause(field)
+		if err != nil {
+			return nil, err
+		}
+		filter.SelectClauses = append(filter.SelectClauses, operand)
+	}
+	if e.Where == nil {
+		return filter, nil
+	}
+	where, err := e.Where.filter()
+	if err != nil {
+		return nil, err
+	}
+	if where != nil {
+		filter.WhereClause = where
+	}
+	return filter, nil
+}
+
+// selectClause returns the operand selecting field, a browse path from the BaseEventType like "ActiveState/Id",
+// with the syntax of the browse paths of mappings without the leading "/".
+func selectClause(field string) (*ua.SimpleAttributeOperand, error) {
+	if field == conditionIDField {
+		return &ua.SimpleAttributeOperand{
+			TypeDefinitionID: ua.NewNumericNodeID(0, id.ConditionType),
+			AttributeID:      ua.AttributeIDNodeID,
+		}, nil
+	}
+	elements, err := splitBrowsePath(field)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event field %s: %s", field, err)
+	}
+	operand := &ua.SimpleAttributeOperand{
+		TypeDefinitionID: ua.NewNumericNodeID(0, id.BaseEventType),
+		AttributeID:      ua.AttributeIDValue,
+	}
+	for _, element := range elements {
+		name := &ua.QualifiedName{Name: element.name}
+		if element.namespace != "" {
+			ns, err := strconv.ParseUint(element.namespace, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event field %s: invalid namespace index %s", field, element.namespace)
+			}
+			name.NamespaceIndex = uint16(ns)
+		}
+		if name.Name == "" {
+			return nil, fmt.Errorf("invalid event field %s: empty name", field)
+		}
+		operand.BrowsePath = append(operand.BrowsePath, name)
+	}
+	return operand, nil
+}
+
+// filterNode is an element of a ContentFilter. Its operands are filterNodes or operands of the filter.
+type filterNode struct {
+	operator ua.FilterOperator
+	operands []interface{}
+}
+
+// filter returns the ContentFilter of w, nil when it has no conditions.
+func (w *eventWhere) filter() (*ua.ContentFilter, error) {
+	var conditions []*filterNode
+	var types *filterNode
+	for _, t := range w.OfType {
+		typeID, err := ua.ParseNodeID(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event type %s: %s", t, err)
+		}
+		types = either(types, &filterNode{
+			operator: ua.FilterOperatorOfType,
+			operands: []interface{}{&ua.LiteralOperand{Value: ua.MustVariant(typeID)}},
+		})
+	}
+	if types != nil {
+		conditions = append(conditions, types)
+	}
+	if w.MinSeverity > 1000 {
+		return nil, fmt.Errorf("invalid minSeverity %d, must be between 1 and 1000", w.MinSeverity)
+	}
+	if w.MinSeverity > 0 {
+		severity, _ := selectClause("Severity")
+		conditions = append(conditions, &filterNode{
+			operator: ua.FilterOperatorGreaterThanOrEqual,
+			operands: []interface{}{severity, &ua.LiteralOperand{Value: ua.MustVariant(w.MinSeverity)}},
+		})
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	root := conditions[0]
+	for _, c := range conditions[1:] {
+		root = &filterNode{operator: ua.FilterOperatorAnd, operands: []interface{}{root, c}}
+	}
+	where := &ua.ContentFilter{}
+	root.flatten(where)
+	return where, nil
+}
+
+// either returns the Or of a and b, b when a is nil.
+func either(a, b *filterNode) *filterNode {
+	if a == nil {
+		return b
+	}
+	return &filterNode{operator: ua.FilterOperatorOr, operands: []interface{}{a, b}}
+}
+
+// flatten appends n and its operands to filter, n first as the first element is the root of the filter,
+// and returns the index of n.
+func (n *filterNode) flatten(filter *ua.ContentFilter) uint32 {
+	index := uint32(len(filter.Elements))
+	element := &ua.ContentFilterElement{FilterOperator: n.operator}
+	filter.Elements = append(filter.Elements, element)
+	for _, operand := range n.operands {
+		switch o := operand.(type) {
+		case *filterNode:
+			element.FilterOperands = append(element.FilterOperands,
+				extensionObject(id.ElementOperand_Encoding_DefaultBinary, &ua.ElementOperand{Index: o.flatten(filter)}))
+		case *ua.LiteralOperand:
+			element.FilterOperands = append(element.FilterOperands,
+				extensionObject(id.LiteralOperand_Encoding_DefaultBinary, o))
+		case *ua.SimpleAttributeOperand:
+			element.FilterOperands = append(element.FilterOperands,
+				extensionObject(id.SimpleAttributeOperand_Encoding_DefaultBinary, o))
+		}
+	}
+	return index
+}
+
+// extensionObject returns value binary encoded with the encoding node typeID.
+func extensionObject(typeID uint32, value interface{}) *ua.ExtensionObject {
+	return &ua.ExtensionObject{
+		EncodingMask: ua.ExtensionObjectBinary,
+		TypeID:       &ua.ExpandedNodeID{NodeID: ua.NewNumericNodeID(0, typeID)},
+		Value:        value,
+	}
+}
+
+// eventJSON returns the fields of an event as JSON object of the field names to their values.
+func eventJSON(names []string, fields []*ua.Variant, structures *structureCache) (string, error) {
+	event := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if i >= len(fields) {
+			event[name] = nil
+			continue
+		}
+		value, err := jsonValue(fields[i], structures)
+		if err != nil {
+			return "", fmt.Errorf("event field %s: %s", name, err)
+		}
+		event[name] = value
+	}
+	b, err := json.Marshal(event)
+	return string(b), err
+}
+
+// eventTime returns the Time and ReceiveTime of an event as SourceTimestamp and ServerTimestamp, for origin.
+func eventTime(names []string, fields []*ua.Variant) *ua.DataValue {
+	dataValue := &ua.DataValue{}
+	for i, name := range names {
+		if i >= len(fields) || fields[i] == nil {
+			continue
+		}
+		t, ok := fields[i].Value().(time.Time)
+		switch {
+		case !ok:
+		case name == "Time":
+			dataValue.SourceTimestamp = t
+		case name == "ReceiveTime":
+			dataValue.ServerTimestamp = t
+		}
+	}
+	return dataValue
+}
@@ -0,0 +1,75 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestEventFilter(t *testing.T) {
+	m, err := parseMapping(`{"node": "i=2253", "events": {"select": ["EventId", "ConditionId", "3:Alarm/ActiveState/Id"],
+		"where": {"ofType": ["i=2915", "i=2130"], "minSeverity": 500}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.attribute != ua.AttributeIDEventNotifier || m.events == nil {
+		t.Fatalf("expected the events of the EventNotifier, got %+v", *m)
+	}
+	filter, err := m.events.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.SelectClauses) != 3 || filter.SelectClauses[1].AttributeID != ua.AttributeIDNodeID {
+		t.Errorf("unexpected select clauses %+v", filter.SelectClauses)
+	}
+	path := filter.SelectClauses[2].BrowsePath
+	if len(path) != 3 || path[0].NamespaceIndex != 3 || path[0].Name != "Alarm" || path[2].Name != "Id" {
+		t.Errorf("unexpected browse path %+v", path)
+	}
+
+	// And(Or(OfType, OfType), GreaterThanOrEqual), the root first
+	operators := []ua.FilterOperator{ua.FilterOperatorAnd, ua.FilterOperatorOr, ua.FilterOperatorOfType,
+		ua.FilterOperatorOfType, ua.FilterOperatorGreaterThanOrEqual}
+	elements := filter.WhereClause.Elements
+	if len(elements) != len(operators) {
+		t.Fatalf("expected %d elements, got %d", len(operators), len(elements))
+	}
+	for i, operator := range operators {
+		if elements[i].FilterOperator != operator {
+			t.Errorf("element %d: expected operator %d, got %d", i, operator, elements[i].FilterOperator)
+		}
+	}
+	for i, expected := range []uint32{1, 4} {
+		operand, ok := elements[0].FilterOperands[i].Value.(*ua.ElementOperand)
+		if !ok || operand.Index != expected {
+			t.Errorf("operand %d of the root: expected element %d, got %+v", i, expected, elements[0].FilterOperands[i].Value)
+		}
+	}
+
+	m, err = parseMapping(`{"node": "i=2253", "events": {}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter, err := m.events.filter(); err != nil || len(filter.SelectClauses) != len(defaultEventFields) ||
+		filter.WhereClause == nil || len(filter.WhereClause.Elements) != 0 {
+		t.Errorf("expected the default fields with an empty where clause, got %+v %v", filter, err)
+	}
+	m, err = parseMapping(`{"node": "i=2253", "events": {"where": {}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter, err := m.events.filter(); err != nil || filter.WhereClause == nil || len(filter.WhereClause.Elements) != 0 {
+		t.Errorf("expected an empty where clause without conditions, got %+v %v", filter, err)
+	}
+
+	for _, invalid := range []string{
+		`{"node": "i=2253", "attribute": "DisplayName", "events": {}}`,
+		`{"node": "i=2253", "events": {"select": ["x:Message"]}}`,
+		`{"node": "i=2253", "events": {"select": ["Message/"]}}`,
+		`{"node": "i=2253", "events": {"where": {"minSeverity": 1001}}}`,
+	} {
+		if _, err := parseMapping(invalid); err == nil {
+			t.Errorf("parseMapping(%s): expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sdk "github.com/edgexfoundry/device-sdk-go"
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// aggregates are the aggregate functions a history command can request by name
+var aggregates = map[string]uint32{
+	"Average":       id.AggregateFunction_Average,
+	"Minimum":       id.AggregateFunction_Minimum,
+	"Maximum":       id.AggregateFunction_Maximum,
+	"Count":         id.AggregateFunction_Count,
+	"TimeAverage":   id.AggregateFunction_TimeAverage,
+	"Interpolative": id.AggregateFunction_Interpolative,
+}
+
+// historyRequest is the value of the HistMark resource of a history command, e.g.
+// {"start":"2019-11-05T10:00:00Z","end":"2019-11-05T11:00:00Z","maxValues":1000}, or for hourly averages
+// {"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","aggregate":"Average","interval":"1h"}
+type historyRequest struct {
+	Start     string `json:"start"`     // RFC3339
+	End       string `json:"end"`       // RFC3339
+	MaxValues uint32 `json:"maxValues"` // per resource, 0 means all values in the window
+	Modified  bool   `json:"modified"`  // read the replaced and deleted values instead of the current ones
+	Aggregate string `json:"aggregate"` // aggregate function computed by the server, none for the raw values
+	Interval  string `json:"interval"`  // processing interval of the aggregate, e.g. "1h", none for the whole window
+}
+
+// historyQuery is a validated historyRequest.
+type historyQuery struct {
+	start     time.Time
+	end       time.Time
+	maxValues uint32
+	modified  bool
+	aggregate uint32 // 0 for the raw values
+	interval  time.Duration
+}
+
+// parseHistoryQuery parses the value of the HistMark resource.
+func parseHistoryQuery(s string) (*historyQuery, error) {
+	var req historyRequest
+	if err := json.Unmarshal([]byte(s), &req); err != nil {
+		return nil, fmt.Errorf("invalid history request %s: %s", s, err)
+	}
+	start, err := time.Parse(time.RFC3339Nano, req.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history start %s: %s", req.Start, err)
+	}
+	end, err := time.Parse(time.RFC3339Nano, req.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history end %s: %s", req.End, err)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("history start %s isn't before end %s", req.Start, req.End)
+	}
+	query := &historyQuery{start: start, end: end, maxValues: req.MaxValues, modified: req.Modified}
+	if req.Aggregate == "" {
+		if req.Interval != "" {
+			return nil, fmt.Errorf("history interval %s without aggregate", req.Interval)
+		}
+		return query, nil
+	}
+	aggregate, ok := aggregates[req.Aggregate]
+	if !ok {
+		return nil, fmt.Errorf("unknown history aggregate %s", req.Aggregate)
+	}
+	if req.Modified {
+		return nil, fmt.Errorf("history aggregate %s of modified values", req.Aggregate)
+	}
+	query.aggregate = aggregate
+	if req.Interval != "" {
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid history interval %s", req.Interval)
+		}
+		query.interval = interval
+	}
+	return query, nil
+}
+
+// details returns the HistoryReadDetails of q.
+func (q *historyQuery) details() *ua.ExtensionObject {
+	if q.aggregate != 0 {
+		return &ua.ExtensionObject{
+			EncodingMask: ua.ExtensionObjectBinary,
+			TypeID:       &ua.ExpandedNodeID{NodeID: ua.NewNumericNodeID(0, id.ReadProcessedDetails_Encoding_DefaultBinary)},
+			Value: &ua.ReadProcessedDetails{
+				StartTime:              q.start,
+				EndTime:                q.end,
+				ProcessingInterval:     float64(q.interval) / float64(time.Millisecond),
+				AggregateType:          []*ua.NodeID{ua.NewNumericNodeID(0, q.aggregate)},
+				AggregateConfiguration: &ua.AggregateConfiguration{UseServerCapabilitiesDefaults: true},
+			},
+		}
+	}
+	return &ua.ExtensionObject{
+		EncodingMask: ua.ExtensionObjectBinary,
+		TypeID:       &ua.ExpandedNodeID{NodeID: ua.NewNumericNodeID(0, id.ReadRawModifiedDetails_Encoding_DefaultBinary)},
+		Value: &ua.ReadRawModifiedDetails{
+			IsReadModified:   q.modified,
+			StartTime:        q.start,
+			EndTime:          q.end,
+			NumValuesPerNode: q.maxValues,
+		},
+	}
+}
+
+// historyNodes resolves the nodes of the device resources names to read the history of. A command selecting no
+// resource or a node without history fails before any HistoryRead is sent.
+func historyNodes(client *opcua.Client, config *Configuration, nodeMapping map[string]string, names []string) ([]*ua.NodeID, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no device resource selected to read the history of")
+	}
+	nodes, errs := resolveNodes(client, config, nodeMapping, names)
+	ids := make([]*ua.NodeID, len(nodes))
+	for i, name := range names {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("Invalid node of DeviceResource:%s: %s", name, errs[i])
+		}
+		if nodes[i].attribute != ua.AttributeIDValue {
+			return nil, fmt.Errorf("DeviceResource:%s: only the Value attribute has a history", name)
+		}
+		ids[i] = nodes[i].id
+	}
+	sessions.structures(config).prepare(client, ids, sessions.operationLimits(config).maxNodesPerRead)
+	return ids, nil
+}
+
+// readHistory reads the history of nodes, of the device resources names, within the window of query and sends it
+// to AsyncCh as readings stamped with their SourceTimestamp, so gaps after an outage can be backfilled. It stops
+// when ctx is cancelled.
+func readHistory(ctx context.Context, deviceName string, config *Configuration, client *opcua.Client,
+	query *historyQuery, names []string, nodes []*ua.NodeID) {
+	defer wg.Done()
+	details := query.details()
+	for i, name := range names {
+		indexRange := ""
+		if deviceObject, ok := sdk.RunningService().DeviceResource(deviceName, name, "get"); ok {
+			indexRange = deviceObject.Attributes[indexRangeAttribute]
+		}
+		count := 0
+		err := readNodeHistory(ctx, client, details, nodes[i], indexRange, query.maxValues, func(values []*ua.DataValue) {
+			cvs := make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+			for _, value := range values {
+				cvs = append(cvs, toCommandValue(value, deviceName, name, config, timestampSource)...)
+				if len(cvs) >= ReadingArrLen {
+					sentToAsynCh(cvs, deviceName)
+					cvs = make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+				}
+			}
+			if len(cvs) > 0 {
+				sentToAsynCh(cvs, deviceName)
+			}
+			count += len(values)
+		})
+		if err == context.Canceled {
+			driver.Logger.Info(fmt.Sprintf("[History] device=%s resource=%s cancelled after %d values", deviceName, name, count))
+			return
+		}
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("[History] device=%s resource=%s failed after %d values: %s", deviceName, name, count, err))
+			if se, ok := err.(*serviceError); ok && se.broken() {
+				sessions.invalidate(config, client)
+				return
+			}
+			continue
+		}
+		driver.Logger.Info(fmt.Sprintf("[History] device=%s resource=%s read %d values", deviceName, name, count))
+	}
+}
+
+// readNodeHistory reads the history of node as selected by details and passes its values to handle, following
+// the continuation points of the server until all or maxValues values are read, 0 means all, or ctx is cancelled.
+func readNodeHistory(ctx context.Context, client *opcua.Client, details *ua.ExtensionObject, node *ua.NodeID, indexRange string,
+	maxValues uint32, handle func([]*ua.DataValue)) error {
+	var continuationPoint []byte
+	var count uint32
+	for {
+		if err := ctx.Err(); err != nil {
+			if len(continuationPoint) > 0 {
+				_, _ = historyRead(client, details, &ua.HistoryReadValueID{NodeID: node, ContinuationPoint: continuationPoint}, true)
+			}
+			return err
+		}
+		result, err := historyRead(client, details, &ua.HistoryReadValueID{
+			NodeID:            node,
+			IndexRange:        indexRange,
+			ContinuationPoint: continuationPoint,
+		}, false)
+		if err != nil {
+			return err
+		}
+		if severity(result.StatusCode) == severityBad {
+			return result.StatusCode
+		}
+		values, err := historyValues(result.HistoryData)
+		if err != nil {
+			return err
+		}
+		if maxValues > 0 && count+uint32(len(values)) > maxValues {
+			values = values[:maxValues-count]
+		}
+		handle(values)
+		count += uint32(len(values))
+
+		continuationPoint = result.ContinuationPoint
+		if len(continuationPoint) == 0 {
+			return nil
+		}
+		if maxValues > 0 && count >= maxValues {
+			// free the continuation point on the server, its values aren't wanted
+			_, err := historyRead(client, details, &ua.HistoryReadValueID{NodeID: node, ContinuationPoint: continuationPoint}, true)
+			return err
+		}
+	}
+}
+
+// historyRead sends a HistoryReadRequest for one node.
+func historyRead(client *opcua.Client, details *ua.ExtensionObject, node *ua.HistoryReadValueID, release bool) (*ua.HistoryReadResult, error) {
+	var result *ua.HistoryReadResult
+	err := client.Send(&ua.HistoryReadRequest{
+		HistoryReadDetails:        details,
+		TimestampsToReturn:        ua.TimestampsToReturnBoth,
+		ReleaseContinuationPoints: release,
+		NodesToRead:               []*ua.HistoryReadValueID{node},
+	}, func(v interface{}) error {
+		resp, ok := v.(*ua.HistoryReadResponse)
+		if !ok {
+			return fmt.Errorf("unexpected response %T", v)
+		}
+		if len(resp.Results) != 1 {
+			return fmt.Errorf("HistoryRead returned %d results for 1 node", len(resp.Results))
+		}
+		result = resp.Results[0]
+		return nil
+	})
+	if err != nil {
+		return nil, &serviceError{service: "HistoryRead", err: err}
+	}
+	return result, nil
+}
+
+// historyValues returns the values of the HistoryData of a HistoryReadResult.
+func historyValues(data *ua.ExtensionObject) ([]*ua.DataValue, error) {
+	if data == nil || data.Value == nil {
+		return nil, nil
+	}
+	switch v := data.Value.(type) {
+	case *ua.HistoryData:
+		return v.DataValues, nil
+	case *ua.HistoryModifiedData:
+		return v.DataValues, nil
+	}
+	return nil, fmt.Errorf("unsupported history data %T", data.Value)
+}
@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	query, err := parseHistoryQuery(`{"start":"2019-11-05T10:00:00Z","end":"2019-11-05T11:00:00.5Z","maxValues":1000}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !query.start.Equal(time.Date(2019, 11, 5, 10, 0, 0, 0, time.UTC)) ||
+		!query.end.Equal(time.Date(2019, 11, 5, 11, 0, 0, 500000000, time.UTC)) ||
+		query.maxValues != 1000 || query.modified {
+		t.Errorf("unexpected query %+v", query)
+	}
+
+	query, err = parseHistoryQuery(`{"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","aggregate":"Average","interval":"1h"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.aggregate != id.AggregateFunction_Average || query.interval != time.Hour {
+		t.Errorf("unexpected query %+v", query)
+	}
+	details, ok := query.details().Value.(*ua.ReadProcessedDetails)
+	if !ok || details.ProcessingInterval != 3600000 {
+		t.Errorf("unexpected details %+v", query.details().Value)
+	}
+
+	for _, invalid := range []string{
+		`{"start":"2019-11-05T10:00:00Z"}`,
+		`{"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","aggregate":"Median"}`,
+		`{"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","interval":"1h"}`,
+		`{"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","aggregate":"Average","interval":"-1h"}`,
+		`{"start":"2019-11-04T00:00:00Z","end":"2019-11-05T00:00:00Z","aggregate":"Average","modified":true}`,
+		`{"start":"2019-11-05 10:00","end":"2019-11-05T11:00:00Z"}`,
+		`{"start":"2019-11-05T11:00:00Z","end":"2019-11-05T10:00:00Z"}`,
+		`on`,
+	} {
+		if _, err := parseHistoryQuery(invalid); err == nil {
+			t.Errorf("parseHistoryQuery(%s): expected an error", invalid)
+		}
+	}
+}
+
+func TestHistoryValues(t *testing.T) {
+	values := []*ua.DataValue{{}, {}}
+	for _, data := range []interface{}{&ua.HistoryData{DataValues: values}, &ua.HistoryModifiedData{DataValues: values}} {
+		v, err := historyValues(&ua.ExtensionObject{Value: data})
+		if err != nil || len(v) != 2 {
+			t.Errorf("historyValues(%T): expected 2 values, got %d %v", data, len(v), err)
+		}
+	}
+	if v, err := historyValues(nil); err != nil || v != nil {
+		t.Errorf("historyValues(nil): expected no values, got %v %v", v, err)
+	}
+	if _, err := historyValues(&ua.ExtensionObject{Value: &ua.ReadRawModifiedDetails{}}); err == nil {
+		t.Error("historyValues(ReadRawModifiedDetails): expected an error")
+	}
+}
+
+func TestReadNodeHistoryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := readNodeHistory(ctx, nil, nil, nil, "", 0, func([]*ua.DataValue) {
+		t.Error("expected no values after cancel")
+	})
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestHistoryNodes(t *testing.T) {
+	if _, err := historyNodes(nil, nil, nil, nil); err == nil {
+		t.Error("historyNodes: expected an error without device resources")
+	}
+}
@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"fmt"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// userIdentity returns the client options which authenticate the session with the user identity
+// configured for the device. Anonymous is used when neither Username nor UserCertFile is configured.
+func userIdentity(config *Configuration, ep *ua.EndpointDescription) ([]opcua.Option, error) {
+	if config.UserCertFile != "" || config.UserKeyFile != "" {
+		return certificateIdentity(config, ep)
+	}
+	if config.Username == "" {
+		if _, err := selectUserTokenPolicy(ep, ua.UserTokenTypeAnonymous); err != nil {
+			return nil, err
+		}
+		return []opcua.Option{
+			opcua.AuthAnonymous(),
+			opcua.SecurityFromEndpoint(ep, ua.UserTokenTypeAnonymous),
+		}, nil
+	}
+
+	policy, err := selectUserTokenPolicy(ep, ua.UserTokenTypeUserName)
+	if err != nil {
+		return nil, err
+	}
+	// the opcua library encrypts the password under this policy when activating the session
+	if tokenSecurityPolicy(ep, policy) == ua.SecurityPolicyURINone {
+		driver.Logger.Warn(fmt.Sprintf("password of user %s is sent unencrypted to %s, token policy %s uses no security",
+			config.Username, ep.EndpointURL, policy.PolicyID))
+	}
+	return []opcua.Option{
+		opcua.AuthUsername(config.Username, config.Password),
+		opcua.SecurityFromEndpoint(ep, ua.UserTokenTypeUserName),
+	}, nil
+}
+
+// certificateIdentity returns the client options of an X.509 user identity token. The token is signed
+// with the user key, which proves the possession of the certificate to the server.
+func certificateIdentity(config *Configuration, ep *ua.EndpointDescription) ([]opcua.Option, error) {
+	if config.Username != "" {
+		return nil, fmt.Errorf("configure either Username or UserCertFile as user identity, not both")
+	}
+	if config.UserCertFile == "" || config.UserKeyFile == "" {
+		return nil, fmt.Errorf("X.509 user identity needs both UserCertFile and UserKeyFile")
+	}
+	if _, err := selectUserTokenPolicy(ep, ua.UserTokenTypeCertificate); err != nil {
+		return nil, err
+	}
+	cert, err := loadCertificate(config.UserCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserCertFile: %s", err)
+	}
+	key, err := loadPrivateKey(config.UserKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UserKeyFile: %s", err)
+	}
+	return []opcua.Option{
+		opcua.AuthCertificate(cert),
+		opcua.AuthPrivateKey(key),
+		opcua.SecurityFromEndpoint(ep, ua.UserTokenTypeCertificate),
+	}, nil
+}
+
+// userTokenType returns the token type of the user identity configured for the device.
+func userTokenType(config *Configuration) ua.UserTokenType {
+	switch {
+	case config.UserCertFile != "" || config.UserKeyFile != "":
+		return ua.UserTokenTypeCertificate
+	case config.Username != "":
+		return ua.UserTokenTypeUserName
+	}
+	return ua.UserTokenTypeAnonymous
+}
+
+// selectUserTokenPolicy returns the first user token policy of ep with the given token type.
+func selectUserTokenPolicy(ep *ua.EndpointDescription, tokenType ua.UserTokenType) (*ua.UserTokenPolicy, error) {
+	offered := make([]string, 0, len(ep.UserIdentityTokens))
+	for _, policy := range ep.UserIdentityTokens {
+		if policy == nil {
+			continue
+		}
+		if policy.TokenType == tokenType {
+			return policy, nil
+		}
+		offered = append(offered, policy.TokenType.String())
+	}
+	return nil, fmt.Errorf("endpoint %s (%s, %s) offers no %s user token policy, offered: %v",
+		ep.EndpointURL, ep.SecurityPolicyURI, ep.SecurityMode, tokenType, offered)
+}
+
+// tokenSecurityPolicy returns the security policy used to protect the secret of a user token.
+// A token policy without its own security policy uses the one of the endpoint.
+func tokenSecurityPolicy(ep *ua.EndpointDescription, policy *ua.UserTokenPolicy) string {
+	if policy.SecurityPolicyURI != "" {
+		return policy.SecurityPolicyURI
+	}
+	return ep.SecurityPolicyURI
+}
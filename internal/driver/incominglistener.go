@@ -8,8 +8,10 @@ import (
 	sdk "github.com/edgexfoundry/device-sdk-go"
 	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
 	"github.com/gopcua/opcua"
-	"github.com/gopcua/opcua/monitor"
+	"github.com/gopcua/opcua/ua"
 	"io/ioutil"
+	"reflect"
+	"sync"
 	"time"
 )
 
@@ -20,144 +22,549 @@ const (
 	WaitingDuration 	=  1000 * time.Millisecond			// time duration of sent a event
 )
 
-// CMS is a group of opcua_client, node monitor, subscription related, opcua_nodes and cancel func.
+// cmsLock guards cmsMap, which is used by command handlers and supervisors concurrently
+var cmsLock sync.Mutex
+
+// CMS is a group of opcua_client, subscription related, opcua_nodes and cancel func.
 type CMS struct {
+	mu			sync.Mutex
+	deviceName	string
+	config		*Configuration
+	nodeMapping	map[string]string
 	client  	*opcua.Client
-	monitor 	*monitor.NodeMonitor
-	sub     	*monitor.Subscription
+	sub     	*opcua.Subscription
 	nodes   	map[string]bool   		// key-value struct of valueDescriptor name and subscribe state
+	handles		map[uint32]string		// client handle of a monitored item to valueDescriptor name
+	items		map[string]uint32		// valueDescriptor name to monitored item id
+	monitorings	map[string]monitoring	// valueDescriptor name to MonitoringParameters of its monitored item
+	fields		map[uint32][]string		// client handle of a monitored item of events to the names of their fields
+	nextHandle	uint32
+	generation	uint64					// generation of the NamespaceArray the nodes were resolved with
 	cancel      context.CancelFunc		// callback cancel function when stop subscription
 }
 
 // start listening for data change massage
 func startListening(deviceName string, config *Configuration, nodeMapping map[string]string, nodes map[string]bool) {
-	subCtx, cancel := context.WithCancel(ctx)
+	cmsLock.Lock()
 	cms, exist := cmsMap[deviceName]
+	if exist && !cms.sameSubscription(config) {
+		// the session or the subscription parameters changed, start over with a new subscription
+		cms.cancel()
+		delete(cmsMap, deviceName)
+		exist = false
+	}
 	if exist {
+		cmsLock.Unlock()
+		cms.mu.Lock()
 		var toAdd, toRemove []string  // toAdd/toRemove represents new nodes to subscribe and old nodes to unsubscribe
 		for node := range nodes{
 			if nodes[node] && !cms.nodes[node] {
-				toAdd = append(toAdd, nodeMapping[node])
+				toAdd = append(toAdd, node)
 			} else if !nodes[node] && cms.nodes[node] {
-				toRemove = append(toRemove, nodeMapping[node])
+				toRemove = append(toRemove, node)
 			}
 		}
-		_ = cms.sub.AddNodes(toAdd...)
-		_ = cms.sub.RemoveNodes(toRemove...)
 		cms.nodes = nodes	// update cms when changed
+		cms.config = config
+		cms.nodeMapping = nodeMapping
+		if cms.sub != nil {
+			// otherwise the supervisor is reconnecting and will monitor cms.nodes afterwards
+			if err := cms.monitor(toAdd...); err != nil {
+				driver.Logger.Error(fmt.Sprintf("failed to subscribe nodes %v of device=%s: %s", toAdd, deviceName, err))
+			}
+			cms.unmonitor(toRemove...)
+			if err := cms.modify(); err != nil {
+				driver.Logger.Error(fmt.Sprintf("failed to modify the subscription of device=%s: %s", deviceName, err))
+			}
+		}
+		cms.mu.Unlock()
 
 		// we wish user always want to stop subscription, so let stop=true.
 		// if any of node's state is true, which means user want to subscribe one node at least, so let stop=false.
 		// if stop=true still, stop the subscription and delete CMS.
 		stop := true
-		for _, state := range cms.nodes {
+		for _, state := range nodes {
 			if state {
 				stop = false
 				break
 			}
 		}
 		if stop {
-			cms.cancel()
-			delete(cmsMap, deviceName)
+			stopListening(deviceName)
+			return
 		}
 		saveSubState()  // save to file
 		return
 	}
 
-	// nodeIds array contains the node ids that need to subscribe
-	nodeIds := make([]string, 0)
+	subscribed := false
 	for node := range nodes {
 		if nodes[node] {
-			nodeIds = append(nodeIds, nodeMapping[node])
+			subscribed = true
+			break
 		}
 	}
-	if len(nodeIds) < 1 {  // all node state is off
+	if !subscribed { // all node state is off
+		cmsLock.Unlock()
 		return
 	}
+	subCtx, cancel := context.WithCancel(ctx)
+	cms = &CMS{
+		deviceName:  deviceName,
+		config:      config,
+		nodeMapping: nodeMapping,
+		nodes:       nodes,
+		cancel:      cancel,
+	}
+	cmsMap[deviceName] = cms
+	cmsLock.Unlock()
+	saveSubState() // save to file
+
 	wg.Add(1)  // wg is a WaitingGroup waiting for clean up work finished
 	defer wg.Done()
-	// create an opcua client and open connection based on config
-	c, err := createClient(config)
+	cms.supervise(subCtx)
+}
+
+// stopListening cancels the subscription of device and forgets it.
+func stopListening(deviceName string) {
+	cmsLock.Lock()
+	cms, ok := cmsMap[deviceName]
+	if ok {
+		cms.cancel()
+		delete(cmsMap, deviceName)
+	}
+	cmsLock.Unlock()
+	if ok {
+		saveSubState()
+	}
+}
+
+// sameSubscription reports whether config keeps the session and the subscription parameters of cms, so its
+// subscription can be kept.
+func (cms *CMS) sameSubscription(config *Configuration) bool {
+	cms.mu.Lock()
+	current := cms.config
+	cms.mu.Unlock()
+	if sessionKey(current) != sessionKey(config) {
+		return false
+	}
+	currentParams, err := subscriptionParameters(current)
 	if err != nil {
-		driver.Logger.Error(fmt.Sprintf("failed to create OPCUA c: %s", err))
-		return
+		return false
 	}
-	defer c.Close()
-	// create node Monitor
-	nodeMonitor, _ := monitor.NewNodeMonitor(c)
-
-	/**
-	 * @deprecated. handle function when data change massage was dropped
-	 * nodeMonitor.SetErrorHandler(func(_ *opcua.Client, sub *monitor.Subscription, err error) {
-	 * 	//driver.Logger.Error(fmt.Sprintf("error when subscribe device=%s : err=%s", deviceName, err.Error()))
-	 * })
-	 */
-	// make a channel for data change
-	notifyCh := make(chan *monitor.DataChangeMessage, MassageChanCap)
-	defer close(notifyCh)
-
-	sub, _ := nodeMonitor.ChanSubscribe(subCtx, notifyCh, nodeIds...)
-	defer sub.Unsubscribe()
-	cmsMap[deviceName] = &CMS{
-		client: 	c,
-		monitor:	nodeMonitor,
-		sub:    	sub,
-		nodes:    	nodes,
-		cancel:		cancel,
-	}
-	saveSubState()  // save to file
-	driver.Logger.Info(fmt.Sprintf("start subscribe device=%s", deviceName))
-
-	// reverse nodeMapping, bind nodeId with node
-	for node, Id := range nodeMapping {
-		nodeMapping[Id] = node
-	}
-	cvs := make([]*sdkModel.CommandValue, 0, ReadingArrLen)
-	ticker := time.NewTicker(WaitingDuration)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <- subCtx.Done():
-			// cancel fun was called then ctx was done
-			return
-		case msg := <-notifyCh:
-			deviceResource := nodeMapping[msg.NodeID.String()]
-			cv := toCommandValue(msg.Value.Value(), deviceName, deviceResource) // reading
-			cvs = append(cvs, cv)  // event
-			if len(cvs) >= ReadingArrLen {
-				sentToAsynCh(cvs, deviceName)
-				cvs = make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+	params, err := subscriptionParameters(config)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(currentParams, params)
+}
+
+// subscribe creates a new subscription on client and monitors every subscribed node.
+// Caller must hold cms.mu.
+func (cms *CMS) subscribe(client *opcua.Client) error {
+	params, err := subscriptionParameters(cms.config)
+	if err != nil {
+		return err
+	}
+	params.Notifs = make(chan *opcua.PublishNotificationData, MassageChanCap)
+	sub, err := client.Subscribe(params)
+	if err != nil {
+		return &serviceError{service: "CreateSubscription", err: err}
+	}
+	driver.Logger.Info(fmt.Sprintf("device=%s subscription %d publishes every %s, lifetime %d, keep-alive %d",
+		cms.deviceName, sub.SubscriptionID, sub.RevisedPublishingInterval, sub.RevisedLifetimeCount, sub.RevisedMaxKeepAliveCount))
+	cms.client = client
+	cms.sub = sub
+	cms.handles = make(map[uint32]string)
+	cms.items = make(map[string]uint32)
+	cms.monitorings = make(map[string]monitoring)
+	cms.fields = make(map[uint32][]string)
+	cms.generation = sessions.refreshNamespaces(cms.config, client)
+
+	var nodes []string
+	for node, state := range cms.nodes {
+		if state {
+			nodes = append(nodes, node)
+		}
+	}
+	return cms.monitor(nodes...)
+}
+
+// monitor creates monitored items of the mapped attribute, by default the Value, for nodes, or of the EventNotifier
+// for the events of nodes. Caller must hold cms.mu.
+func (cms *CMS) monitor(nodes ...string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	resolved, errs := resolveNodes(cms.client, cms.config, cms.nodeMapping, nodes)
+	pending := cms.prepareItems(nodes, resolved, errs)
+	if len(pending.reqs) == 0 {
+		return nil
+	}
+	resp, err := createItems(cms.client, cms.config, cms.sub, pending)
+	if err != nil {
+		return err
+	}
+	cms.commitItems(pending, resp)
+	return nil
+}
+
+// pendingItems are the monitored items of nodes to create, whose handles are reserved.
+type pendingItems struct {
+	reqs        []*ua.MonitoredItemCreateRequest
+	names       []string
+	monitorings []monitoring
+}
+
+// prepareItems returns the requests of the monitored items of nodes, resolved with errs. Caller must hold cms.mu.
+func (cms *CMS) prepareItems(nodes []string, resolved []*resolvedNode, errs []error) *pendingItems {
+	pending := &pendingItems{}
+	for i, node := range nodes {
+		if errs[i] != nil {
+			driver.Logger.Error(fmt.Sprintf("failed to subscribe device=%s node=%s: %s", cms.deviceName, node, errs[i]))
+			continue
+		}
+		m, err := cms.monitoring(node)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("failed to subscribe device=%s node=%s: %s", cms.deviceName, node, err))
+			continue
+		}
+		id := resolved[i].id
+		cms.nextHandle++
+		cms.handles[cms.nextHandle] = node
+		req := opcua.NewMonitoredItemCreateRequestWithDefaults(id, resolved[i].attribute, cms.nextHandle)
+		req.RequestedParameters = m.parameters(cms.nextHandle)
+		if m.events != nil {
+			cms.fields[cms.nextHandle] = cms.eventFields(node)
+		}
+		if deviceObject, ok := sdk.RunningService().DeviceResource(cms.deviceName, node, "get"); ok {
+			req.ItemToMonitor.IndexRange = deviceObject.Attributes[indexRangeAttribute]
+		}
+		pending.reqs = append(pending.reqs, req)
+		pending.names = append(pending.names, node)
+		pending.monitorings = append(pending.monitorings, m)
+	}
+	return pending
+}
+
+// createItems creates the pending monitored items on sub, after reading the structured DataTypes of their values.
+// It calls the server, so callers should not hold cms.mu.
+func createItems(client *opcua.Client, config *Configuration, sub *opcua.Subscription, pending *pendingItems) (*ua.CreateMonitoredItemsResponse, error) {
+	ids := make([]*ua.NodeID, 0, len(pending.reqs))
+	for _, req := range pending.reqs {
+		if req.ItemToMonitor.AttributeID == ua.AttributeIDValue {
+			ids = append(ids, req.ItemToMonitor.NodeID)
+		}
+	}
+	sessions.structures(config).prepare(client, ids, sessions.operationLimits(config).maxNodesPerRead)
+	resp, err := sub.Monitor(ua.TimestampsToReturnBoth, pending.reqs...)
+	if err != nil {
+		return nil, &serviceError{service: "CreateMonitoredItems", err: err}
+	}
+	return resp, nil
+}
+
+// commitItems records the monitored items created for pending and returns the ids of those whose node was
+// unsubscribed meanwhile, to be deleted. Caller must hold cms.mu.
+func (cms *CMS) commitItems(pending *pendingItems, resp *ua.CreateMonitoredItemsResponse) []uint32 {
+	var stale []uint32
+	for i, res := range resp.Results {
+		if res.StatusCode != ua.StatusOK {
+			driver.Logger.Error(fmt.Sprintf("failed to subscribe device=%s node=%s: %s", cms.deviceName, pending.names[i], res.StatusCode))
+			continue
+		}
+		if !cms.nodes[pending.names[i]] {
+			handle := pending.reqs[i].RequestedParameters.ClientHandle
+			delete(cms.handles, handle)
+			delete(cms.fields, handle)
+			stale = append(stale, res.MonitoredItemID)
+			continue
+		}
+		cms.items[pending.names[i]] = res.MonitoredItemID
+		cms.monitorings[pending.names[i]] = pending.monitorings[i]
+	}
+	return stale
+}
+
+// monitoring returns the monitoring of node, set by its attributes in the device profile and by its mapping.
+// Caller must hold cms.mu.
+func (cms *CMS) monitoring(node string) (monitoring, error) {
+	var attributes map[string]string
+	if deviceObject, ok := sdk.RunningService().DeviceResource(cms.deviceName, node, "get"); ok {
+		attributes = deviceObject.Attributes
+	}
+	mapped, err := parseMapping(cms.nodeMapping[node])
+	if err != nil {
+		return monitoring{}, err
+	}
+	m, err := newMonitoring(attributes, mapped.monitoring)
+	if err != nil || mapped.events == nil {
+		return m, err
+	}
+	m.events, err = mapped.events.filter()
+	return m, err
+}
+
+// eventFields returns the names of the fields selected from the events of node. Caller must hold cms.mu.
+func (cms *CMS) eventFields(node string) []string {
+	mapped, err := parseMapping(cms.nodeMapping[node])
+	if err != nil || mapped.events == nil {
+		return nil
+	}
+	return mapped.events.fields()
+}
+
+// modify changes the MonitoringParameters of the monitored items whose monitoring changed since they were
+// created, e.g. by a new device profile. Caller must hold cms.mu.
+func (cms *CMS) modify() error {
+	var items []*ua.MonitoredItemModifyRequest
+	var names []string
+	var monitorings []monitoring
+	for handle, node := range cms.handles {
+		itemID, ok := cms.items[node]
+		if !ok {
+			continue
+		}
+		m, err := cms.monitoring(node)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("failed to modify device=%s node=%s: %s", cms.deviceName, node, err))
+			continue
+		}
+		if reflect.DeepEqual(m, cms.monitorings[node]) {
+			continue
+		}
+		items = append(items, &ua.MonitoredItemModifyRequest{
+			MonitoredItemID:     itemID,
+			RequestedParameters: m.parameters(handle),
+		})
+		if m.events != nil {
+			cms.fields[handle] = cms.eventFields(node)
+		}
+		names = append(names, node)
+		monitorings = append(monitorings, m)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return cms.client.Send(&ua.ModifyMonitoredItemsRequest{
+		SubscriptionID:     cms.sub.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToModify:      items,
+	}, func(v interface{}) error {
+		resp, ok := v.(*ua.ModifyMonitoredItemsResponse)
+		if !ok || len(resp.Results) != len(items) {
+			return fmt.Errorf("unexpected response %T", v)
+		}
+		for i, res := range resp.Results {
+			if res.StatusCode != ua.StatusOK {
+				driver.Logger.Error(fmt.Sprintf("failed to modify device=%s node=%s: %s", cms.deviceName, names[i], res.StatusCode))
+				continue
 			}
-		case <- ticker.C:
-			if len(cvs) > 0 {
-				sentToAsynCh(cvs, deviceName)
-				cvs = cvs[:0]
-				//cvs = make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+			cms.monitorings[names[i]] = monitorings[i]
+		}
+		return nil
+	})
+}
+
+// remonitor monitors the subscribed nodes again when the NamespaceArray of the server changed since they were
+// resolved, e.g. by a download to the PLC, so NodeIds with a namespace URI and browse paths follow their nodes.
+// It calls the server without holding cms.mu, so a slow server doesn't block the commands of the device, and
+// caller must not hold it.
+func (cms *CMS) remonitor() error {
+	cms.mu.Lock()
+	dependent := false
+	for _, mapping := range cms.nodeMapping {
+		if dependsOnNamespaces(mapping) {
+			dependent = true
+			break
+		}
+	}
+	client, sub, config, nodeMapping, current := cms.client, cms.sub, cms.config, cms.nodeMapping, cms.generation
+	cms.mu.Unlock()
+	if !dependent || sub == nil {
+		return nil
+	}
+	generation := sessions.refreshNamespaces(config, client)
+	if generation == current {
+		return nil
+	}
+
+	cms.mu.Lock()
+	if cms.sub != sub {
+		// subscribed again meanwhile, with the current NamespaceArray
+		cms.mu.Unlock()
+		return nil
+	}
+	cms.generation = generation
+	var nodes []string
+	for node, state := range cms.nodes {
+		if state {
+			nodes = append(nodes, node)
+		}
+	}
+	ids := cms.forget(nodes...)
+	cms.mu.Unlock()
+	driver.Logger.Info(fmt.Sprintf("device=%s resubscribing nodes after the NamespaceArray changed", cms.deviceName))
+	cms.deleteItems(sub, nodes, ids)
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	resolved, errs := resolveNodes(client, config, nodeMapping, nodes)
+	cms.mu.Lock()
+	pending := cms.prepareItems(nodes, resolved, errs)
+	cms.mu.Unlock()
+	if len(pending.reqs) == 0 {
+		return nil
+	}
+	resp, err := createItems(client, config, sub, pending)
+	if err != nil {
+		return err
+	}
+	cms.mu.Lock()
+	stale := cms.commitItems(pending, resp)
+	cms.mu.Unlock()
+	cms.deleteItems(sub, pending.names, stale)
+	return nil
+}
+
+// unmonitor deletes the monitored items of nodes. Caller must hold cms.mu.
+func (cms *CMS) unmonitor(nodes ...string) {
+	cms.deleteItems(cms.sub, nodes, cms.forget(nodes...))
+}
+
+// forget drops the monitored items of nodes and returns their ids, to be deleted by deleteItems.
+// Caller must hold cms.mu.
+func (cms *CMS) forget(nodes ...string) []uint32 {
+	ids := make([]uint32, 0, len(nodes))
+	for _, node := range nodes {
+		if id, ok := cms.items[node]; ok {
+			ids = append(ids, id)
+			delete(cms.items, node)
+			delete(cms.monitorings, node)
+		}
+		for handle, name := range cms.handles {
+			if name == node {
+				delete(cms.handles, handle)
+				delete(cms.fields, handle)
 			}
 		}
 	}
+	return ids
+}
+
+// deleteItems deletes the monitored items ids of nodes from sub.
+func (cms *CMS) deleteItems(sub *opcua.Subscription, nodes []string, ids []uint32) {
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := sub.Unmonitor(ids...); err != nil {
+		driver.Logger.Warn(fmt.Sprintf("failed to unsubscribe nodes %v of device=%s: %s", nodes, cms.deviceName, err))
+	}
 }
 
-func toCommandValue(data interface{}, deviceName string, deviceResource string) *sdkModel.CommandValue {
-	//driver.Logger.Info(fmt.Sprintf("[Incoming listener] Incoming reading received: name=%v deviceResource=%v value=%v", deviceName, deviceResource, data))
+// handleNotification converts a data change or an event notification into readings.
+func (cms *CMS) handleNotification(data interface{}, cvs []*sdkModel.CommandValue) []*sdkModel.CommandValue {
+	if events, ok := data.(*ua.EventNotificationList); ok {
+		return cms.handleEvents(events, cvs)
+	}
+	change, ok := data.(*ua.DataChangeNotification)
+	if !ok {
+		return cvs
+	}
+	for _, item := range change.MonitoredItems {
+		cms.mu.Lock()
+		deviceResource, ok := cms.handles[item.ClientHandle]
+		config := cms.config
+		cms.mu.Unlock()
+		if !ok || item.Value == nil {
+			continue
+		}
+		cvs = append(cvs, toCommandValue(item.Value, cms.deviceName, deviceResource, config, "")...) // event
+	}
+	return cvs
+}
+
+// handleEvents converts each event into a String reading of the JSON object of its selected fields, stamped
+// with its Time by the source timestamp policy, with its ReceiveTime by the server one.
+func (cms *CMS) handleEvents(events *ua.EventNotificationList, cvs []*sdkModel.CommandValue) []*sdkModel.CommandValue {
+	for _, event := range events.Events {
+		cms.mu.Lock()
+		deviceResource, ok := cms.handles[event.ClientHandle]
+		names := cms.fields[event.ClientHandle]
+		config := cms.config
+		cms.mu.Unlock()
+		if !ok {
+			continue
+		}
+		deviceObject, ok := sdk.RunningService().DeviceResource(cms.deviceName, deviceResource, "get")
+		if !ok {
+			driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming event ignored. No DeviceObject found: name=%v deviceResource=%v", cms.deviceName, deviceResource))
+			continue
+		}
+		value, err := eventJSON(names, event.EventFields, sessions.structures(config))
+		if err != nil {
+			driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming event ignored. name=%v deviceResource=%v: %s", cms.deviceName, deviceResource, err))
+			continue
+		}
+		req := sdkModel.CommandRequest{
+			DeviceResourceName: deviceResource,
+			Type:               sdkModel.ParseValueType(deviceObject.Properties.Value.Type),
+		}
+		resTime := origin(eventTime(names, event.EventFields), timestampPolicy(config, deviceObject.Attributes))
+		result, err := newResult(req, value, resTime)
+		if err != nil {
+			driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming event ignored. name=%v deviceResource=%v: %s", cms.deviceName, deviceResource, err))
+			continue
+		}
+		cvs = append(cvs, result)
+	}
+	return cvs
+}
+
+// toCommandValue converts a monitored or historical value into a reading, stamped according to policy or,
+// if it is empty, to the timestamp policy of the device resource, followed by its companion quality reading.
+// Values rejected by the quality policy only yield the quality reading.
+func toCommandValue(dataValue *ua.DataValue, deviceName string, deviceResource string, config *Configuration, policy string) []*sdkModel.CommandValue {
+	//driver.Logger.Info(fmt.Sprintf("[Incoming listener] Incoming reading received: name=%v deviceResource=%v value=%v", deviceName, deviceResource, dataValue.Value))
 	deviceObject, ok := sdk.RunningService().DeviceResource(deviceName, deviceResource, "get")
 	if !ok {
-		driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming reading ignored. No DeviceObject found: name=%v deviceResource=%v value=%v", deviceName, deviceResource, data))
+		driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming reading ignored. No DeviceObject found: name=%v deviceResource=%v value=%v", deviceName, deviceResource, dataValue.Value))
 		return nil
 	}
 
+	var cvs []*sdkModel.CommandValue
+	if policy == "" {
+		policy = timestampPolicy(config, deviceObject.Attributes)
+	}
+	resTime := origin(dataValue, policy)
+	if q := qualityReading(deviceName, deviceResource, dataValue.Status, resTime); q != nil {
+		cvs = append(cvs, q)
+	}
+	if !acceptQuality(dataValue.Status, qualityPolicy(config, deviceObject.Attributes)) {
+		driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming reading ignored. name=%v deviceResource=%v status=%v", deviceName, deviceResource, dataValue.Status))
+		return cvs
+	}
+	if dataValue.Value == nil {
+		return cvs
+	}
+
 	req := sdkModel.CommandRequest{
 		DeviceResourceName: deviceResource,
 		Type:               sdkModel.ParseValueType(deviceObject.Properties.Value.Type),
 	}
 
-	result, err := newResult(req, data)
+	data, err := sessions.structures(config).decodeValue(variantValue(dataValue.Value))
+	if err != nil {
+		driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming reading ignored. name=%v deviceResource=%v: %s", deviceName, deviceResource, err))
+		return cvs
+	}
+	result, err := newResult(req, data, resTime)
 	if err != nil {
 		driver.Logger.Warn(fmt.Sprintf("[Incoming listener] Incoming reading ignored. name=%v deviceResource=%v value=%v", deviceName, deviceResource, data))
-		return nil
+		return cvs
 	}
-	return result
+	return append([]*sdkModel.CommandValue{result}, cvs...)
 }
 
 // sent event to asynchronous channel
@@ -171,10 +578,14 @@ func sentToAsynCh(cvs []*sdkModel.CommandValue, deviceName string)  {
 
 func saveSubState() {
 	subState := make(map[string]map[string]bool)
+	cmsLock.Lock()
 	for deviceName, cms := range cmsMap {
+		cms.mu.Lock()
 		subState[deviceName] = cms.nodes
+		cms.mu.Unlock()
 	}
 	jsonStr, err := json.MarshalIndent(subState, "", "    ")
+	cmsLock.Unlock()
 	if err != nil {
 		driver.Logger.Error(fmt.Sprintf("failed to marsh node state: %s", err))
 		return
@@ -198,4 +609,4 @@ func loadSubState() {
 		config, nodeMapping, _ := CreateConfigurationAndMapping(device.Protocols)
 		go startListening(deviceName, config, nodeMapping, nodes)
 	}
-}
\ No newline at end of file
+}
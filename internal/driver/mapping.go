@@ -0,0 +1,130 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/spf13/cast"
+)
+
+// mappedNode is the node mapping of a device resource. It is given either as the node itself, or as JSON object
+// naming an attribute or a property of the node, e.g. {"node":"ns=3;s=X","attribute":"DisplayName"} or
+// {"node":"ns=3;s=X","property":"EURange"}, and the monitoring of its subscription, e.g.
+// {"node":"ns=3;s=X","monitoring":{"samplingInterval":"100ms","deadbandType":"absolute","deadband":0.5}}, or the events
+// of a notifier node, see eventMapping. A resource mapped to a method of conditions, e.g. {"condition":"Acknowledge"},
+// has no node, see conditionCommand. A resource mapped to a method of an object, e.g.
+// {"node":"ns=3;s=Recipes","method":"ns=3;s=Recipes.Load"}, calls it when written, see methodCall.
+type mappedNode struct {
+	node       string            // NodeId, NodeId with namespace URI or browse path
+	property   string            // BrowseName of a property of node to use instead of node
+	attribute  ua.AttributeID    // attribute of the node, Value by default
+	monitoring map[string]string // settings of the monitored item, see monitoring.apply
+	events     *eventMapping     // EventFilter of the events of node, whose EventNotifier is monitored then
+	condition  string            // method of conditions called by writing the resource, see conditionMethods
+	method     string            // NodeId, NodeId with namespace URI or browse path of a method of node
+	callOnRead bool              // reading the resource calls method too, instead of returning the last outputs
+	inputs     string            // JSON input arguments of method when the resource is read, with callOnRead
+}
+
+type objectMapping struct {
+	Node       string                 `json:"node"`
+	Attribute  string                 `json:"attribute"`
+	Property   string                 `json:"property"`
+	Monitoring map[string]interface{} `json:"monitoring"`
+	Events     *eventMapping          `json:"events"`
+	Condition  string                 `json:"condition"`
+	Method     string                 `json:"method"`
+	CallOnRead bool                   `json:"callOnRead"`
+	Inputs     json.RawMessage        `json:"inputs"`
+}
+
+// attributeIDs are the attributes a device resource can be mapped to by name
+var attributeIDs = map[string]ua.AttributeID{
+	"NodeId":                  ua.AttributeIDNodeID,
+	"NodeClass":               ua.AttributeIDNodeClass,
+	"BrowseName":              ua.AttributeIDBrowseName,
+	"DisplayName":             ua.AttributeIDDisplayName,
+	"Description":             ua.AttributeIDDescription,
+	"WriteMask":               ua.AttributeIDWriteMask,
+	"UserWriteMask":           ua.AttributeIDUserWriteMask,
+	"IsAbstract":              ua.AttributeIDIsAbstract,
+	"EventNotifier":           ua.AttributeIDEventNotifier,
+	"Value":                   ua.AttributeIDValue,
+	"DataType":                ua.AttributeIDDataType,
+	"ValueRank":               ua.AttributeIDValueRank,
+	"ArrayDimensions":         ua.AttributeIDArrayDimensions,
+	"AccessLevel":             ua.AttributeIDAccessLevel,
+	"UserAccessLevel":         ua.AttributeIDUserAccessLevel,
+	"MinimumSamplingInterval": ua.AttributeIDMinimumSamplingInterval,
+	"Historizing":             ua.AttributeIDHistorizing,
+	"Executable":              ua.AttributeIDExecutable,
+	"UserExecutable":          ua.AttributeIDUserExecutable,
+}
+
+// isObjectMapping reports whether mapping is given as JSON object.
+func isObjectMapping(mapping string) bool {
+	return strings.HasPrefix(mapping, "{")
+}
+
+// parseMapping parses the node mapping of a device resource.
+func parseMapping(mapping string) (*mappedNode, error) {
+	if !isObjectMapping(mapping) {
+		return &mappedNode{node: mapping, attribute: ua.AttributeIDValue}, nil
+	}
+	var om objectMapping
+	if err := json.Unmarshal([]byte(mapping), &om); err != nil {
+		return nil, fmt.Errorf("invalid mapping %s: %s", mapping, err)
+	}
+	if om.Condition != "" {
+		if _, ok := conditionMethods[om.Condition]; !ok {
+			return nil, fmt.Errorf("invalid mapping %s: unknown condition method %s", mapping, om.Condition)
+		}
+		return &mappedNode{condition: om.Condition, attribute: ua.AttributeIDValue}, nil
+	}
+	if om.Node == "" {
+		return nil, fmt.Errorf("invalid mapping %s: no node", mapping)
+	}
+	m := &mappedNode{node: om.Node, property: om.Property, attribute: ua.AttributeIDValue}
+	if om.Attribute != "" {
+		attribute, ok := attributeIDs[om.Attribute]
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %s: unknown attribute %s", mapping, om.Attribute)
+		}
+		m.attribute = attribute
+	}
+	if m.property != "" && m.attribute != ua.AttributeIDValue {
+		return nil, fmt.Errorf("invalid mapping %s: either a property or an attribute", mapping)
+	}
+	if om.Method != "" {
+		if om.Attribute != "" || m.property != "" || om.Events != nil {
+			return nil, fmt.Errorf("invalid mapping %s: a method has no attribute, property or events", mapping)
+		}
+		if len(om.Inputs) > 0 && !om.CallOnRead {
+			return nil, fmt.Errorf("invalid mapping %s: inputs are only used with callOnRead", mapping)
+		}
+		m.method, m.callOnRead, m.inputs = om.Method, om.CallOnRead, string(om.Inputs)
+	}
+	if om.Events != nil {
+		if om.Attribute != "" || m.property != "" {
+			return nil, fmt.Errorf("invalid mapping %s: events of a node have no attribute or property", mapping)
+		}
+		if _, err := om.Events.filter(); err != nil {
+			return nil, fmt.Errorf("invalid mapping %s: %s", mapping, err)
+		}
+		m.events = om.Events
+		m.attribute = ua.AttributeIDEventNotifier
+	}
+	if len(om.Monitoring) > 0 {
+		m.monitoring = make(map[string]string, len(om.Monitoring))
+		for k, v := range om.Monitoring {
+			m.monitoring[k] = cast.ToString(v)
+		}
+		check := defaultMonitoring
+		if err := check.apply(m.monitoring); err != nil {
+			return nil, fmt.Errorf("invalid mapping %s: %s", mapping, err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestCreateNodeMapping(t *testing.T) {
+	mapping, err := createNodeMapping(`{
+		"Counter": "ns=5;s=Counter1",
+		"Name": {"node": "ns=3;s=X", "attribute": "DisplayName"},
+		"Range": {"node": "/Objects/3:PLC_1/3:Temperature", "property": "EURange"}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		resource string
+		expected mappedNode
+	}{
+		{"Counter", mappedNode{node: "ns=5;s=Counter1", attribute: ua.AttributeIDValue}},
+		{"Name", mappedNode{node: "ns=3;s=X", attribute: ua.AttributeIDDisplayName}},
+		{"Range", mappedNode{node: "/Objects/3:PLC_1/3:Temperature", property: "EURange", attribute: ua.AttributeIDValue}},
+	}
+	for _, test := range tests {
+		m, err := parseMapping(mapping[test.resource])
+		if err != nil {
+			t.Errorf("%s: %s", test.resource, err)
+			continue
+		}
+		if m.node != test.expected.node || m.property != test.expected.property || m.attribute != test.expected.attribute {
+			t.Errorf("%s: expected %+v, got %+v", test.resource, test.expected, *m)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"X": {"attribute": "DisplayName"}}`,
+		`{"X": {"node": "ns=3;s=X", "attribute": "Color"}}`,
+		`{"X": {"node": "ns=3;s=X", "attribute": "DisplayName", "property": "EURange"}}`,
+		`{"X": 5}`,
+	} {
+		if _, err := createNodeMapping(invalid); err == nil {
+			t.Errorf("createNodeMapping(%s): expected an error", invalid)
+		}
+	}
+}
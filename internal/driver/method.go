@@ -0,0 +1,339 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+	"github.com/spf13/cast"
+)
+
+// inputArgumentsProperty is the BrowseName of the property of a method describing its input arguments.
+const inputArgumentsProperty = "InputArguments"
+
+// outputsLock guards methodOutputs, the results of the last successful call of each method resource by
+// outputKey, which reading the resource returns without calling the method again.
+var outputsLock sync.Mutex
+var methodOutputs = make(map[string]*methodOutput)
+
+// methodOutput is the result of a method call and the time it was received.
+type methodOutput struct {
+	result  *ua.CallMethodResult
+	resTime int64
+}
+
+// outputKey is the key of the outputs of the method resource of a device in methodOutputs.
+func outputKey(deviceName, resource string) string {
+	return deviceName + "/" + resource
+}
+
+// saveOutputs keeps result as the last outputs of the method resource of a device.
+func saveOutputs(deviceName, resource string, result *ua.CallMethodResult, resTime int64) {
+	outputsLock.Lock()
+	methodOutputs[outputKey(deviceName, resource)] = &methodOutput{result: result, resTime: resTime}
+	outputsLock.Unlock()
+}
+
+// lastOutputs returns the last outputs of the method resource of a device, nil before its first call.
+func lastOutputs(deviceName, resource string) *methodOutput {
+	outputsLock.Lock()
+	defer outputsLock.Unlock()
+	return methodOutputs[outputKey(deviceName, resource)]
+}
+
+// forgetOutputs drops the outputs of the method resources of a removed device.
+func forgetOutputs(deviceName string) {
+	outputsLock.Lock()
+	defer outputsLock.Unlock()
+	for key := range methodOutputs {
+		if strings.HasPrefix(key, deviceName+"/") {
+			delete(methodOutputs, key)
+		}
+	}
+}
+
+// methodCall returns the call of the method of node with inputs, a JSON array of the input arguments, or the
+// argument itself for a method with one, converted to the DataTypes of the InputArguments of the method.
+func methodCall(client *opcua.Client, config *Configuration, node *resolvedNode, inputs string) (*ua.CallMethodRequest, error) {
+	arguments, err := inputArguments(client, config, node.method)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseInputs(inputs, len(arguments))
+	if err != nil {
+		return nil, err
+	}
+	structures := sessions.structures(config)
+	call := &ua.CallMethodRequest{ObjectID: node.id, MethodID: node.method}
+	for i, argument := range arguments {
+		value, err := argumentValue(values[i], argument, structures.argumentType(client, argument.DataType))
+		if err != nil {
+			return nil, fmt.Errorf("input argument %s: %s", argument.Name, err)
+		}
+		v, err := ua.NewVariant(value)
+		if err != nil {
+			return nil, fmt.Errorf("input argument %s: %s", argument.Name, err)
+		}
+		call.InputArguments = append(call.InputArguments, v)
+	}
+	return call, nil
+}
+
+// inputArguments reads the InputArguments of method. A method without them takes no input arguments.
+func inputArguments(client *opcua.Client, config *Configuration, method *ua.NodeID) ([]*ua.Argument, error) {
+	limits := sessions.operationLimits(config)
+	ids, errs := sessions.nodes(config).resolveProperties(client, []*ua.NodeID{method}, []string{inputArgumentsProperty},
+		limits.maxNodesPerTranslate)
+	if e, ok := errs[0].(*browsePathError); ok && e.err == errNoMatch {
+		return nil, nil
+	}
+	if errs[0] != nil {
+		return nil, fmt.Errorf("failed to resolve the %s of method %s: %s", inputArgumentsProperty, method, errs[0])
+	}
+	results, err := readNodes(client, []*ua.ReadValueID{{NodeID: ids[0], AttributeID: ua.AttributeIDValue}}, limits.maxNodesPerRead)
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Status != ua.StatusOK || results[0].Value == nil {
+		return nil, fmt.Errorf("failed to read the %s of method %s: %s", inputArgumentsProperty, method, results[0].Status)
+	}
+	eos, ok := results[0].Value.Value().([]*ua.ExtensionObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s of method %s", inputArgumentsProperty, method)
+	}
+	arguments := make([]*ua.Argument, 0, len(eos))
+	for _, eo := range eos {
+		argument, ok := eo.Value.(*ua.Argument)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s of method %s", inputArgumentsProperty, method)
+		}
+		arguments = append(arguments, argument)
+	}
+	return arguments, nil
+}
+
+// parseInputs parses inputs into the values of n input arguments. For one argument, inputs which aren't a JSON
+// array are its value, or its text if they aren't JSON.
+func parseInputs(inputs string, n int) ([]interface{}, error) {
+	inputs = strings.TrimSpace(inputs)
+	if n == 0 {
+		if inputs != "" && inputs != "[]" {
+			return nil, fmt.Errorf("the method takes no input arguments")
+		}
+		return nil, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(inputs))
+	decoder.UseNumber()
+	if n == 1 && !strings.HasPrefix(inputs, "[") {
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil || decoder.More() {
+			value = inputs
+		}
+		return []interface{}{value}, nil
+	}
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid input arguments %s, must be a JSON array", inputs)
+	}
+	if len(values) != n {
+		return nil, fmt.Errorf("expected %d input arguments, got %d", n, len(values))
+	}
+	return values, nil
+}
+
+// argumentValue converts the JSON value of an input argument to its DataType nt, structures are encoded.
+func argumentValue(value interface{}, argument *ua.Argument, nt *nodeType) (interface{}, error) {
+	if argument.ValueRank >= 0 {
+		return nil, fmt.Errorf("array arguments are not supported")
+	}
+	if nt == nil {
+		return nil, fmt.Errorf("unknown DataType %s", argument.DataType)
+	}
+	if nt.structure == nil {
+		return writeBuiltin(jsonString(value), nt.builtin)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	body, err := encodeStructure(nt.structure, string(b))
+	if err != nil {
+		return nil, err
+	}
+	return &ua.ExtensionObject{
+		EncodingMask: ua.ExtensionObjectBinary,
+		TypeID:       &ua.ExpandedNodeID{NodeID: nt.encodingID},
+		Value:        &rawStructure{body: body},
+	}, nil
+}
+
+// methodResult converts the output arguments of a method call, received at resTime, into the reading of req:
+// one output argument like the value of a node, several as JSON array.
+func methodResult(req sdkModel.CommandRequest, result *ua.CallMethodResult, resTime int64, structures *structureCache) (*sdkModel.CommandValue, error) {
+	if status := callStatus(result); status != ua.StatusOK {
+		return nil, fmt.Errorf("Call failed: %s (0x%08X)", status.Error(), uint32(status))
+	}
+	if len(result.OutputArguments) == 1 && result.OutputArguments[0] != nil {
+		reading, err := structures.decodeValue(variantValue(result.OutputArguments[0]))
+		if err != nil {
+			return nil, err
+		}
+		return newResult(req, reading, resTime)
+	}
+	outputs := make([]interface{}, len(result.OutputArguments))
+	for i, output := range result.OutputArguments {
+		value, err := jsonValue(output, structures)
+		if err != nil {
+			return nil, fmt.Errorf("output argument %d: %s", i, err)
+		}
+		outputs[i] = value
+	}
+	reading, err := arrayToJSON(outputs)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(req, reading, resTime)
+}
+
+// readMethods returns the output arguments of the methods of reqs, mapped to nodes, as readings in the order of
+// reqs: those of their last call by a write command, so reading has no side effects. Methods whose mapping
+// opts in with callOnRead are called with the inputs of their mappings instead. A failed call is logged and
+// has no reading; a method which wasn't called yet fails the command.
+func readMethods(client *opcua.Client, deviceName string, config *Configuration, nodeMapping map[string]string,
+	reqs []sdkModel.CommandRequest, nodes []*resolvedNode) ([]*sdkModel.CommandValue, error) {
+	responses := make([]*sdkModel.CommandValue, len(reqs))
+	calls := make([]*ua.CallMethodRequest, 0, len(reqs))
+	indexes := make([]int, 0, len(reqs)) // indexes[i] is the request of calls[i]
+	structures := sessions.structures(config)
+	for i, req := range reqs {
+		m, err := parseMapping(nodeMapping[req.DeviceResourceName])
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %s %v", req.DeviceResourceName, err))
+			continue
+		}
+		if !m.callOnRead {
+			output := lastOutputs(deviceName, req.DeviceResourceName)
+			if output == nil {
+				return nil, fmt.Errorf("DeviceResource:%s: method not yet called, write the resource to call it", req.DeviceResourceName)
+			}
+			if responses[i], err = methodResult(req, output.result, output.resTime, structures); err != nil {
+				driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %s %v", req.DeviceResourceName, err))
+			}
+			continue
+		}
+		call, err := methodCall(client, config, nodes[i], m.inputs)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %s %v", req.DeviceResourceName, err))
+			continue
+		}
+		calls = append(calls, call)
+		indexes = append(indexes, i)
+	}
+	if len(calls) == 0 {
+		return responses, nil
+	}
+	results, err := callMethods(client, calls, sessions.operationLimits(config).maxNodesPerCall)
+	if err != nil {
+		return nil, err
+	}
+	resTime := time.Now().UnixNano()
+	for j, result := range results {
+		req := reqs[indexes[j]]
+		res, err := methodResult(req, result, resTime, structures)
+		if err != nil {
+			driver.Logger.Error(fmt.Sprintf("Handle read commands failed: %s %v", req.DeviceResourceName, err))
+			continue
+		}
+		responses[indexes[j]] = res
+	}
+	return responses, nil
+}
+
+// callMethodResources calls the methods of the requests whose device resource is mapped to one, with their
+// parameters as inputs, and returns the other requests with their parameters, to be written. A write command
+// returns no readings, so the output arguments are sent as async readings before the command returns, and kept
+// for the read commands of the resource. A method the server refuses fails the command with its StatusCode.
+func callMethodResources(client *opcua.Client, deviceName string, config *Configuration, nodeMapping map[string]string,
+	reqs []sdkModel.CommandRequest, params []*sdkModel.CommandValue) ([]sdkModel.CommandRequest, []*sdkModel.CommandValue, error) {
+	var writeReqs, methodReqs []sdkModel.CommandRequest
+	var writeParams, methodParams []*sdkModel.CommandValue
+	for i, req := range reqs {
+		if m, err := parseMapping(nodeMapping[req.DeviceResourceName]); err == nil && m.method != "" {
+			methodReqs = append(methodReqs, req)
+			methodParams = append(methodParams, params[i])
+			continue
+		}
+		writeReqs = append(writeReqs, req)
+		writeParams = append(writeParams, params[i])
+	}
+	if len(methodReqs) == 0 {
+		return writeReqs, writeParams, nil
+	}
+
+	names := make([]string, len(methodReqs))
+	for i, req := range methodReqs {
+		names[i] = req.DeviceResourceName
+	}
+	resolved, errs := resolveNodes(client, config, nodeMapping, names)
+	calls := make([]*ua.CallMethodRequest, len(methodReqs))
+	for i, req := range methodReqs {
+		if errs[i] != nil {
+			return nil, nil, fmt.Errorf("Invalid node of DeviceResource:%s: %s", names[i], errs[i])
+		}
+		inputs, err := methodParams[i].StringValue()
+		if req.Type != sdkModel.String {
+			var value interface{}
+			if value, err = newCommandValue(req.Type, methodParams[i]); err == nil {
+				inputs = cast.ToString(value)
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("DeviceResource:%s: %s", names[i], err)
+		}
+		if calls[i], err = methodCall(client, config, resolved[i], inputs); err != nil {
+			return nil, nil, fmt.Errorf("DeviceResource:%s: %s", names[i], err)
+		}
+	}
+
+	results, err := callMethods(client, calls, sessions.operationLimits(config).maxNodesPerCall)
+	if err != nil {
+		return nil, nil, err
+	}
+	structures := sessions.structures(config)
+	resTime := time.Now().UnixNano()
+	callErr := &writeError{service: "Call"}
+	var cvs []*sdkModel.CommandValue
+	for i, result := range results {
+		if status := callStatus(result); status != ua.StatusOK {
+			callErr.failures = append(callErr.failures, writeFailure{
+				resource: names[i],
+				nodeId:   calls[i].MethodID.String(),
+				status:   status,
+			})
+			continue
+		}
+		driver.Logger.Info(fmt.Sprintf("Called %s %v", names[i], methodParams[i]))
+		saveOutputs(deviceName, names[i], result, resTime)
+		if len(result.OutputArguments) == 0 {
+			continue
+		}
+		res, err := methodResult(methodReqs[i], result, resTime, structures)
+		if err != nil {
+			driver.Logger.Warn(fmt.Sprintf("Output arguments of %s ignored: %s", names[i], err))
+			continue
+		}
+		cvs = append(cvs, res)
+	}
+	if len(cvs) > 0 {
+		sentToAsynCh(cvs, deviceName)
+	}
+	if len(callErr.failures) > 0 {
+		return nil, nil, callErr
+	}
+	return writeReqs, writeParams, nil
+}
@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestParseInputs(t *testing.T) {
+	tests := []struct {
+		inputs   string
+		n        int
+		expected []interface{}
+	}{
+		{"", 0, nil},
+		{"[]", 0, nil},
+		{`[7, "Cake", true]`, 3, []interface{}{json.Number("7"), "Cake", true}},
+		{"7", 1, []interface{}{json.Number("7")}},
+		{`"Cake"`, 1, []interface{}{"Cake"}},
+		{"Cake", 1, []interface{}{"Cake"}},
+		{"Cake 7", 1, []interface{}{"Cake 7"}},
+		{"[7]", 1, []interface{}{json.Number("7")}},
+	}
+	for _, test := range tests {
+		values, err := parseInputs(test.inputs, test.n)
+		if err != nil {
+			t.Errorf("parseInputs(%s, %d): %s", test.inputs, test.n, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("parseInputs(%s, %d): expected %v, got %v", test.inputs, test.n, test.expected, values)
+		}
+	}
+
+	for _, invalid := range []struct {
+		inputs string
+		n      int
+	}{
+		{"7", 0},
+		{"[7]", 2},
+		{"7, 8", 2},
+	} {
+		if _, err := parseInputs(invalid.inputs, invalid.n); err == nil {
+			t.Errorf("parseInputs(%s, %d): expected an error", invalid.inputs, invalid.n)
+		}
+	}
+}
+
+func TestArgumentValue(t *testing.T) {
+	scalar := &ua.Argument{Name: "Recipe", ValueRank: -1}
+	value, err := argumentValue(json.Number("7"), scalar, &nodeType{builtin: ua.TypeIDInt16})
+	if err != nil || value != int16(7) {
+		t.Errorf("expected Int16 7, got %T %v %v", value, value, err)
+	}
+	if _, err := argumentValue(json.Number("7"), scalar, nil); err == nil {
+		t.Error("expected an error for an unknown DataType")
+	}
+	if _, err := argumentValue("[1, 2]", &ua.Argument{Name: "Steps", ValueRank: 1}, &nodeType{builtin: ua.TypeIDInt16}); err == nil {
+		t.Error("expected an error for an array argument")
+	}
+
+	m, err := parseMapping(`{"node": "ns=3;s=Recipes", "method": "ns=3;s=Recipes.Load"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.node != "ns=3;s=Recipes" || m.method != "ns=3;s=Recipes.Load" || m.callOnRead {
+		t.Errorf("unexpected mapping %+v", *m)
+	}
+	m, err = parseMapping(`{"node": "ns=3;s=Recipes", "method": "ns=3;s=Recipes.Load", "callOnRead": true, "inputs": [7, "Cake"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.callOnRead || m.inputs != `[7, "Cake"]` {
+		t.Errorf("unexpected mapping %+v", *m)
+	}
+	if _, err := parseMapping(`{"node": "ns=3;s=Recipes", "method": "ns=3;s=Recipes.Load", "inputs": [7]}`); err == nil {
+		t.Error("expected an error for inputs without callOnRead")
+	}
+	if _, err := parseMapping(`{"node": "ns=3;s=Recipes", "method": "ns=3;s=Recipes.Load", "attribute": "DisplayName"}`); err == nil {
+		t.Error("expected an error for a method with an attribute")
+	}
+}
+
+func TestMethodOutputs(t *testing.T) {
+	if output := lastOutputs("Oven", "LoadRecipe"); output != nil {
+		t.Fatalf("expected no outputs before the first call, got %+v", output)
+	}
+	result := &ua.CallMethodResult{OutputArguments: []*ua.Variant{nil}}
+	saveOutputs("Oven", "LoadRecipe", result, 42)
+	saveOutputs("Oven2", "LoadRecipe", result, 43)
+	if output := lastOutputs("Oven", "LoadRecipe"); output == nil || output.result != result || output.resTime != 42 {
+		t.Errorf("expected the saved outputs, got %+v", output)
+	}
+	forgetOutputs("Oven")
+	if output := lastOutputs("Oven", "LoadRecipe"); output != nil {
+		t.Errorf("expected no outputs of a removed device, got %+v", output)
+	}
+	if output := lastOutputs("Oven2", "LoadRecipe"); output == nil {
+		t.Error("expected the outputs of another device to be kept")
+	}
+	forgetOutputs("Oven2")
+}
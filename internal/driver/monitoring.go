@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// attributes of a device resource, or settings of the monitoring of its mapping, tuning its monitored item
+const (
+	samplingIntervalAttribute = "samplingInterval" // duration like "100ms", or milliseconds
+	queueSizeAttribute        = "queueSize"        // number of values the server queues between publishes
+	discardOldestAttribute    = "discardOldest"    // "true" drops the oldest value when the queue is full
+	deadbandTypeAttribute     = "deadbandType"     // "absolute" or "percent" of the EURange
+	deadbandAttribute         = "deadband"         // change of the value below which no notification is sent
+)
+
+// monitoring holds the MonitoringParameters of a monitored item.
+type monitoring struct {
+	samplingInterval float64 // milliseconds, 0 is the fastest rate of the server, -1 the publishing interval
+	queueSize        uint32
+	discardOldest    bool
+	deadbandType     ua.DeadbandType
+	deadband         float64
+	events           *ua.EventFilter // filter of the events of a notifier node, nil for data changes
+}
+
+// defaultMonitoring are the MonitoringParameters of NewMonitoredItemCreateRequestWithDefaults of the opcua library.
+var defaultMonitoring = monitoring{queueSize: 10, discardOldest: true}
+
+// newMonitoring returns the monitoring of a device resource: the defaults changed by each of settings in order,
+// i.e. the attributes of the resource in the device profile and the monitoring of its mapping.
+func newMonitoring(settings ...map[string]string) (monitoring, error) {
+	m := defaultMonitoring
+	for _, s := range settings {
+		if err := m.apply(s); err != nil {
+			return m, err
+		}
+	}
+	if m.deadband != 0 && m.deadbandType == ua.DeadbandTypeNone {
+		return m, fmt.Errorf("%s %v without %s", deadbandAttribute, m.deadband, deadbandTypeAttribute)
+	}
+	return m, nil
+}
+
+func (m *monitoring) apply(settings map[string]string) error {
+	if v, ok := settings[samplingIntervalAttribute]; ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			m.samplingInterval = float64(d) / float64(time.Millisecond)
+		} else if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			m.samplingInterval = ms
+		} else {
+			return fmt.Errorf("invalid %s %s", samplingIntervalAttribute, v)
+		}
+	}
+	if v, ok := settings[queueSizeAttribute]; ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s", queueSizeAttribute, v)
+		}
+		m.queueSize = uint32(n)
+	}
+	if v, ok := settings[discardOldestAttribute]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s", discardOldestAttribute, v)
+		}
+		m.discardOldest = b
+	}
+	if v, ok := settings[deadbandTypeAttribute]; ok {
+		switch v {
+		case "none":
+			m.deadbandType = ua.DeadbandTypeNone
+		case "absolute":
+			m.deadbandType = ua.DeadbandTypeAbsolute
+		case "percent":
+			m.deadbandType = ua.DeadbandTypePercent
+		default:
+			return fmt.Errorf("invalid %s %s, must be absolute, percent or none", deadbandTypeAttribute, v)
+		}
+	}
+	if v, ok := settings[deadbandAttribute]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid %s %s", deadbandAttribute, v)
+		}
+		m.deadband = f
+	}
+	return nil
+}
+
+// parameters returns the MonitoringParameters of m for the monitored item with clientHandle.
+// A deadband is sent as DataChangeFilter, the events as EventFilter.
+func (m monitoring) parameters(clientHandle uint32) *ua.MonitoringParameters {
+	params := &ua.MonitoringParameters{
+		ClientHandle:     clientHandle,
+		SamplingInterval: m.samplingInterval,
+		QueueSize:        m.queueSize,
+		DiscardOldest:    m.discardOldest,
+	}
+	switch {
+	case m.events != nil:
+		params.Filter = extensionObject(id.EventFilter_Encoding_DefaultBinary, m.events)
+	case m.deadbandType != ua.DeadbandTypeNone:
+		params.Filter = extensionObject(id.DataChangeFilter_Encoding_DefaultBinary, &ua.DataChangeFilter{
+			Trigger:       ua.DataChangeTriggerStatusValue,
+			DeadbandType:  uint32(m.deadbandType),
+			DeadbandValue: m.deadband,
+		})
+	}
+	return params
+}
@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestNewMonitoring(t *testing.T) {
+	attributes := map[string]string{samplingIntervalAttribute: "250ms", queueSizeAttribute: "5", deadbandTypeAttribute: "percent"}
+	mapping := map[string]string{deadbandAttribute: "0.5", discardOldestAttribute: "false", samplingIntervalAttribute: "100"}
+	m, err := newMonitoring(attributes, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := monitoring{samplingInterval: 100, queueSize: 5, discardOldest: false, deadbandType: ua.DeadbandTypePercent, deadband: 0.5}
+	if m != expected {
+		t.Errorf("expected %+v, got %+v", expected, m)
+	}
+	params := m.parameters(7)
+	filter, ok := params.Filter.Value.(*ua.DataChangeFilter)
+	if !ok || filter.DeadbandType != uint32(ua.DeadbandTypePercent) || filter.DeadbandValue != 0.5 || params.ClientHandle != 7 {
+		t.Errorf("unexpected parameters %+v", params)
+	}
+
+	if m, err := newMonitoring(nil); err != nil || m != defaultMonitoring || m.parameters(1).Filter != nil {
+		t.Errorf("expected the defaults without filter, got %+v %v", m, err)
+	}
+
+	for _, invalid := range []map[string]string{
+		{samplingIntervalAttribute: "fast"},
+		{queueSizeAttribute: "-1"},
+		{discardOldestAttribute: "maybe"},
+		{deadbandTypeAttribute: "relative"},
+		{deadbandAttribute: "0.5"},
+	} {
+		if _, err := newMonitoring(invalid); err == nil {
+			t.Errorf("newMonitoring(%v): expected an error", invalid)
+		}
+	}
+}
+
+func TestCommitItems(t *testing.T) {
+	cms := &CMS{
+		nodes:       map[string]bool{"Counter": true, "Random": false},
+		handles:     map[uint32]string{1: "Counter", 2: "Random"},
+		items:       make(map[string]uint32),
+		monitorings: make(map[string]monitoring),
+		fields:      make(map[uint32][]string),
+	}
+	pending := &pendingItems{
+		reqs: []*ua.MonitoredItemCreateRequest{
+			{RequestedParameters: &ua.MonitoringParameters{ClientHandle: 1}},
+			{RequestedParameters: &ua.MonitoringParameters{ClientHandle: 2}},
+		},
+		names:       []string{"Counter", "Random"},
+		monitorings: []monitoring{defaultMonitoring, defaultMonitoring},
+	}
+	resp := &ua.CreateMonitoredItemsResponse{Results: []*ua.MonitoredItemCreateResult{
+		{StatusCode: ua.StatusOK, MonitoredItemID: 10},
+		{StatusCode: ua.StatusOK, MonitoredItemID: 11},
+	}}
+	stale := cms.commitItems(pending, resp)
+	if cms.items["Counter"] != 10 {
+		t.Errorf("expected item 10 of Counter, got %v", cms.items)
+	}
+	if len(stale) != 1 || stale[0] != 11 {
+		t.Errorf("expected the item of the unsubscribed node Random to be deleted, got %v", stale)
+	}
+	if _, ok := cms.handles[2]; ok {
+		t.Error("expected the handle of the unsubscribed node Random to be dropped")
+	}
+}
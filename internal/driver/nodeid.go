@@ -0,0 +1,480 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+const (
+	// remainingPathNone is the RemainingPathIndex of a target the whole browse path was followed to
+	remainingPathNone = 0xFFFFFFFF
+	// namespaceCheckInterval is how often the NamespaceArray is read again to detect changed namespace indexes
+	namespaceCheckInterval = 10 * time.Second
+)
+
+// errNoMatch is the error of a browse path the server found no node for.
+var errNoMatch = fmt.Errorf("no node found")
+
+// browsePathError is the error translating a browse path, named by key.
+type browsePathError struct {
+	key string
+	err error
+}
+
+func (e *browsePathError) Error() string {
+	return fmt.Sprintf("browse path %s: %s", e.key, e.err)
+}
+
+// nodeCache resolves the node mappings of device resources into NodeIds. A mapping is either a NodeId,
+// e.g. "ns=3;s=Counter1", a NodeId with the namespace URI instead of its index, e.g.
+// "nsu=http://www.siemens.com/simatic-s7-opcua;s=Counter1", resolved against the NamespaceArray of the server,
+// or a browse path from the Root folder, e.g. "/Objects/3:PLC_1/3:DB1/3:Temperature", which is translated
+// by the server once per session.
+type nodeCache struct {
+	mu         sync.Mutex
+	paths      map[string]*ua.NodeID // translated browse paths
+	namespaces []string              // NamespaceArray of the server
+	checked    time.Time             // when the NamespaceArray was read
+	generation uint64                // incremented whenever the NamespaceArray changed
+}
+
+func newNodeCache() *nodeCache {
+	return &nodeCache{paths: make(map[string]*ua.NodeID)}
+}
+
+// isBrowsePath reports whether mapping is a browse path rather than a NodeId.
+func isBrowsePath(mapping string) bool {
+	return strings.HasPrefix(mapping, "/")
+}
+
+// isNamespaceURI reports whether mapping is a NodeId with a namespace URI.
+func isNamespaceURI(mapping string) bool {
+	return strings.HasPrefix(mapping, "nsu=")
+}
+
+// dependsOnNamespaces reports whether the NodeId of mapping depends on the NamespaceArray of the server.
+func dependsOnNamespaces(mapping string) bool {
+	return isBrowsePath(mapping) || isNamespaceURI(mapping)
+}
+
+// refresh reads the NamespaceArray of the server, unless it was read within namespaceCheckInterval.
+// When it changed, the translated browse paths are dropped. It returns the generation of the NamespaceArray
+// and whether it changed since the last read.
+func (c *nodeCache) refresh(client *opcua.Client) (uint64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	if time.Since(c.checked) < namespaceCheckInterval {
+		defer c.mu.Unlock()
+		return c.generation, false
+	}
+	c.checked = time.Now()
+	c.mu.Unlock()
+
+	namespaces, err := readNamespaces(client)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		driver.Logger.Warn(fmt.Sprintf("failed to read the NamespaceArray: %s", err))
+		return c.generation, false
+	}
+	if equalNamespaces(c.namespaces, namespaces) {
+		return c.generation, false
+	}
+	changed := c.namespaces != nil
+	c.namespaces = namespaces
+	c.paths = make(map[string]*ua.NodeID)
+	if changed {
+		c.generation++
+	}
+	return c.generation, changed
+}
+
+// readNamespaces reads the NamespaceArray of the server.
+func readNamespaces(client *opcua.Client) ([]string, error) {
+	resp, err := client.Read(&ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{
+			{NodeID: ua.NewNumericNodeID(0, id.Server_NamespaceArray), AttributeID: ua.AttributeIDValue},
+		},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+	})
+	if err != nil {
+		return nil, &serviceError{service: "Read", err: err}
+	}
+	if len(resp.Results) != 1 {
+		return nil, fmt.Errorf("Read returned %d results for 1 node", len(resp.Results))
+	}
+	if resp.Results[0].Status != ua.StatusOK {
+		return nil, resp.Results[0].Status
+	}
+	if resp.Results[0].Value == nil {
+		return nil, fmt.Errorf("no value")
+	}
+	namespaces, ok := resp.Results[0].Value.Value().([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected value %T", resp.Results[0].Value.Value())
+	}
+	return namespaces, nil
+}
+
+func equalNamespaces(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNamespaceURI parses a NodeId "nsu=<namespace URI>;<identifier>" with the index of the URI in namespaces.
+func parseNamespaceURI(mapping string, namespaces []string) (*ua.NodeID, error) {
+	i := strings.Index(mapping, ";")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid node id=%s", mapping)
+	}
+	uri := mapping[len("nsu="):i]
+	for ns, namespace := range namespaces {
+		if namespace == uri {
+			id, err := ua.ParseNodeID(fmt.Sprintf("ns=%d;%s", ns, mapping[i+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid node id=%s", mapping)
+			}
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("namespace %s not in the NamespaceArray of the server", uri)
+}
+
+// resolve returns the NodeIds of mappings in their order. A mapping which can't be resolved has a nil NodeId
+// and its error in errs. The browse paths not translated yet are translated with as few requests as the
+// MaxNodesPerTranslateBrowsePathsToNodeIds limit of the server allows, 0 means no limit.
+func (c *nodeCache) resolve(client *opcua.Client, mappings []string, maxNodesPerTranslate uint32) ([]*ua.NodeID, []error) {
+	ids := make([]*ua.NodeID, len(mappings))
+	errs := make([]error, len(mappings))
+	var paths []*ua.BrowsePath
+	var indexes []int // indexes[i] is the mapping of paths[i]
+	for i, mapping := range mappings {
+		if !dependsOnNamespaces(mapping) {
+			id, err := ua.ParseNodeID(mapping)
+			if err != nil {
+				errs[i] = fmt.Errorf("invalid node id=%s", mapping)
+				continue
+			}
+			ids[i] = id
+			continue
+		}
+		if c == nil {
+			errs[i] = fmt.Errorf("%s: no session", mapping)
+			continue
+		}
+		if isNamespaceURI(mapping) {
+			c.mu.Lock()
+			ids[i], errs[i] = parseNamespaceURI(mapping, c.namespaces)
+			c.mu.Unlock()
+			continue
+		}
+		c.mu.Lock()
+		id, ok := c.paths[mapping]
+		c.mu.Unlock()
+		if ok {
+			ids[i] = id
+			continue
+		}
+		path, err := parseBrowsePath(mapping)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		paths = append(paths, path)
+		indexes = append(indexes, i)
+	}
+	if len(paths) == 0 {
+		return ids, errs
+	}
+
+	keys := make([]string, len(indexes))
+	for j, i := range indexes {
+		keys[j] = mappings[i]
+	}
+	translated, translateErrs := c.translate(client, keys, paths, maxNodesPerTranslate)
+	for j, i := range indexes {
+		ids[i], errs[i] = translated[j], translateErrs[j]
+	}
+	return ids, errs
+}
+
+// resolveProperties returns the NodeIds of the properties of nodes, e.g. the EURange of an analog item, in their order.
+// A property is a BrowseName, prefixed by "<namespace index>:" unless it is in namespace 0. Nodes without property
+// are returned unchanged.
+func (c *nodeCache) resolveProperties(client *opcua.Client, nodes []*ua.NodeID, properties []string, maxNodesPerTranslate uint32) ([]*ua.NodeID, []error) {
+	ids := make([]*ua.NodeID, len(nodes))
+	errs := make([]error, len(nodes))
+	var keys []string
+	var paths []*ua.BrowsePath
+	var indexes []int // indexes[i] is the node of paths[i]
+	for i, node := range nodes {
+		if node == nil || properties[i] == "" {
+			ids[i] = node
+			continue
+		}
+		if c == nil {
+			errs[i] = fmt.Errorf("property %s: no session", properties[i])
+			continue
+		}
+		key := node.String() + "/" + properties[i]
+		c.mu.Lock()
+		cached, ok := c.paths[key]
+		c.mu.Unlock()
+		if ok {
+			ids[i] = cached
+			continue
+		}
+		name, _ := parseQualifiedName(properties[i])
+		keys = append(keys, key)
+		paths = append(paths, &ua.BrowsePath{
+			StartingNode: node,
+			RelativePath: &ua.RelativePath{Elements: []*ua.RelativePathElement{{
+				ReferenceTypeID: ua.NewNumericNodeID(0, id.HasProperty),
+				TargetName:      name,
+			}}},
+		})
+		indexes = append(indexes, i)
+	}
+	if len(paths) == 0 {
+		return ids, errs
+	}
+	translated, translateErrs := c.translate(client, keys, paths, maxNodesPerTranslate)
+	for j, i := range indexes {
+		ids[i], errs[i] = translated[j], translateErrs[j]
+	}
+	return ids, errs
+}
+
+// translate translates paths, named by keys in errors, and caches the NodeIds by key.
+func (c *nodeCache) translate(client *opcua.Client, keys []string, paths []*ua.BrowsePath, maxNodesPerTranslate uint32) ([]*ua.NodeID, []error) {
+	ids := make([]*ua.NodeID, len(paths))
+	errs := make([]error, len(paths))
+	results, err := translateBrowsePaths(client, paths, maxNodesPerTranslate)
+	for i, key := range keys {
+		if err != nil {
+			errs[i] = &browsePathError{key: key, err: err}
+			continue
+		}
+		id, err := browsePathTarget(results[i])
+		if err != nil {
+			errs[i] = &browsePathError{key: key, err: err}
+			continue
+		}
+		ids[i] = id
+		c.mu.Lock()
+		c.paths[key] = id
+		c.mu.Unlock()
+		driver.Logger.Debug(fmt.Sprintf("browse path %s resolved to %s", key, id))
+	}
+	return ids, errs
+}
+
+// translateBrowsePaths translates paths with as few requests as maxNodesPerTranslate allows. The results
+// are in the order of paths.
+func translateBrowsePaths(client *opcua.Client, paths []*ua.BrowsePath, maxNodesPerTranslate uint32) ([]*ua.BrowsePathResult, error) {
+	results := make([]*ua.BrowsePathResult, 0, len(paths))
+	for _, chunk := range chunkIndexes(len(paths), maxNodesPerTranslate) {
+		n := chunk[1] - chunk[0]
+		err := client.Send(&ua.TranslateBrowsePathsToNodeIDsRequest{BrowsePaths: paths[chunk[0]:chunk[1]]}, func(v interface{}) error {
+			resp, ok := v.(*ua.TranslateBrowsePathsToNodeIDsResponse)
+			if !ok {
+				return fmt.Errorf("unexpected response %T", v)
+			}
+			if len(resp.Results) != n {
+				return fmt.Errorf("TranslateBrowsePathsToNodeIds returned %d results for %d paths", len(resp.Results), n)
+			}
+			results = append(results, resp.Results...)
+			return nil
+		})
+		if err != nil {
+			return nil, &serviceError{service: "TranslateBrowsePathsToNodeIds", err: err}
+		}
+	}
+	return results, nil
+}
+
+// browsePathTarget returns the node a browse path was translated to. Paths matching several nodes
+// resolve to the first one, as returned by the server.
+func browsePathTarget(result *ua.BrowsePathResult) (*ua.NodeID, error) {
+	if result.StatusCode == ua.StatusBadNoMatch {
+		return nil, errNoMatch
+	}
+	if result.StatusCode != ua.StatusOK {
+		return nil, result.StatusCode
+	}
+	for _, target := range result.Targets {
+		if target.RemainingPathIndex != remainingPathNone {
+			// the path leads to another server
+			continue
+		}
+		if target.TargetID == nil || target.TargetID.NodeID == nil || target.TargetID.ServerIndex != 0 {
+			continue
+		}
+		return target.TargetID.NodeID, nil
+	}
+	return nil, fmt.Errorf("no node found on this server")
+}
+
+// parseBrowsePath parses a browse path from the Root folder. Its elements are BrowseNames separated by "/",
+// each prefixed by "<namespace index>:" unless it is in namespace 0, following the hierarchical references.
+// "&" escapes a "/" or ":" in a name.
+func parseBrowsePath(s string) (*ua.BrowsePath, error) {
+	if !isBrowsePath(s) || len(s) == 1 {
+		return nil, fmt.Errorf("invalid browse path %s", s)
+	}
+	path := &ua.BrowsePath{
+		StartingNode: ua.NewNumericNodeID(0, id.RootFolder),
+		RelativePath: &ua.RelativePath{},
+	}
+	elements, err := splitBrowsePath(s[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid browse path %s: %s", s, err)
+	}
+	for _, element := range elements {
+		name := &ua.QualifiedName{Name: element.name}
+		if element.namespace != "" {
+			ns, err := strconv.ParseUint(element.namespace, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid browse path %s: invalid namespace index %s", s, element.namespace)
+			}
+			name.NamespaceIndex = uint16(ns)
+		}
+		if name.Name == "" {
+			return nil, fmt.Errorf("invalid browse path %s: empty name", s)
+		}
+		path.RelativePath.Elements = append(path.RelativePath.Elements, &ua.RelativePathElement{
+			ReferenceTypeID: ua.NewNumericNodeID(0, id.HierarchicalReferences),
+			IncludeSubtypes: true,
+			TargetName:      name,
+		})
+	}
+	return path, nil
+}
+
+type browsePathElement struct {
+	namespace string
+	name      string
+}
+
+// splitBrowsePath splits the elements of a browse path at the unescaped "/" and the namespace index of each
+// element at its first unescaped ":".
+func splitBrowsePath(s string) ([]browsePathElement, error) {
+	var elements []browsePathElement
+	var element browsePathElement
+	var name strings.Builder
+	hasNamespace := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '&':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing &")
+			}
+			i++
+			name.WriteByte(s[i])
+		case c == '/':
+			element.name = name.String()
+			elements = append(elements, element)
+			element, hasNamespace = browsePathElement{}, false
+			name.Reset()
+		case c == ':' && !hasNamespace:
+			element.namespace = name.String()
+			hasNamespace = true
+			name.Reset()
+		default:
+			name.WriteByte(c)
+		}
+	}
+	element.name = name.String()
+	return append(elements, element), nil
+}
+
+// resolvedNode is the node and the attribute of it a device resource is mapped to, or the object and its method.
+type resolvedNode struct {
+	id        *ua.NodeID
+	attribute ua.AttributeID
+	method    *ua.NodeID
+}
+
+// resolveNodes returns the nodes of the device resources names, mapped by nodeMapping, in their order.
+// A resource without mapping or whose mapping can't be resolved has a nil node and its error in errs.
+func resolveNodes(client *opcua.Client, config *Configuration, nodeMapping map[string]string, names []string) ([]*resolvedNode, []error) {
+	mapped := make([]*mappedNode, 0, len(names))
+	indexes := make([]int, 0, len(names)) // indexes[i] is the resource of mapped[i]
+	errs := make([]error, len(names))
+	refresh := false
+	for i, name := range names {
+		mapping, ok := nodeMapping[name]
+		if !ok {
+			errs[i] = fmt.Errorf("no NodeId mapped")
+			continue
+		}
+		m, err := parseMapping(mapping)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		mapped = append(mapped, m)
+		indexes = append(indexes, i)
+		refresh = refresh || dependsOnNamespaces(m.node) || dependsOnNamespaces(m.method)
+	}
+	if refresh {
+		sessions.refreshNamespaces(config, client)
+	}
+
+	cache := sessions.nodes(config)
+	maxNodesPerTranslate := sessions.operationLimits(config).maxNodesPerTranslate
+	mappings := make([]string, len(mapped))
+	properties := make([]string, len(mapped))
+	for j, m := range mapped {
+		mappings[j], properties[j] = m.node, m.property
+	}
+	ids, resolveErrs := cache.resolve(client, mappings, maxNodesPerTranslate)
+	ids, propertyErrs := cache.resolveProperties(client, ids, properties, maxNodesPerTranslate)
+	var methods []string
+	var methodIndexes []int // methodIndexes[k] is the mapping of methods[k]
+	for j, m := range mapped {
+		if m.method != "" {
+			methods = append(methods, m.method)
+			methodIndexes = append(methodIndexes, j)
+		}
+	}
+	methodIDs := make([]*ua.NodeID, len(mapped))
+	methodErrs := make([]error, len(mapped))
+	if len(methods) > 0 {
+		resolvedMethods, resolveMethodErrs := cache.resolve(client, methods, maxNodesPerTranslate)
+		for k, j := range methodIndexes {
+			methodIDs[j], methodErrs[j] = resolvedMethods[k], resolveMethodErrs[k]
+		}
+	}
+
+	nodes := make([]*resolvedNode, len(names))
+	for j, i := range indexes {
+		switch {
+		case resolveErrs[j] != nil:
+			errs[i] = resolveErrs[j]
+		case propertyErrs[j] != nil:
+			errs[i] = propertyErrs[j]
+		case methodErrs[j] != nil:
+			errs[i] = fmt.Errorf("method %s: %s", mapped[j].method, methodErrs[j])
+		default:
+			nodes[i] = &resolvedNode{id: ids[j], attribute: mapped[j].attribute, method: methodIDs[j]}
+		}
+	}
+	return nodes, errs
+}
@@ -0,0 +1,75 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestParseBrowsePath(t *testing.T) {
+	path, err := parseBrowsePath("/Objects/3:PLC_1/3:DataBlocksGlobal/3:DB&/1/3:Temp&:A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ua.QualifiedName{
+		{Name: "Objects"},
+		{NamespaceIndex: 3, Name: "PLC_1"},
+		{NamespaceIndex: 3, Name: "DataBlocksGlobal"},
+		{NamespaceIndex: 3, Name: "DB/1"},
+		{NamespaceIndex: 3, Name: "Temp:A"},
+	}
+	if len(path.RelativePath.Elements) != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), len(path.RelativePath.Elements))
+	}
+	for i, element := range path.RelativePath.Elements {
+		if *element.TargetName != expected[i] {
+			t.Errorf("element %d: expected %+v, got %+v", i, expected[i], *element.TargetName)
+		}
+		if element.IsInverse || !element.IncludeSubtypes {
+			t.Errorf("element %d: expected forward hierarchical references", i)
+		}
+	}
+
+	for _, invalid := range []string{"/", "Objects/3:PLC_1", "/Objects//3:PLC_1", "/Objects/x:PLC_1", "/Objects/3:PLC_1&"} {
+		if _, err := parseBrowsePath(invalid); err == nil {
+			t.Errorf("parseBrowsePath(%s): expected an error", invalid)
+		}
+	}
+}
+
+func TestBrowsePathTarget(t *testing.T) {
+	node := &ua.NodeID{}
+	result := &ua.BrowsePathResult{
+		StatusCode: ua.StatusOK,
+		Targets: []*ua.BrowsePathTarget{
+			{TargetID: &ua.ExpandedNodeID{NodeID: &ua.NodeID{}, ServerIndex: 1}, RemainingPathIndex: 2},
+			{TargetID: &ua.ExpandedNodeID{NodeID: node}, RemainingPathIndex: remainingPathNone},
+		},
+	}
+	if id, err := browsePathTarget(result); err != nil || id != node {
+		t.Errorf("expected the target on this server, got %v %v", id, err)
+	}
+	if _, err := browsePathTarget(&ua.BrowsePathResult{StatusCode: ua.StatusBadNoMatch}); err != errNoMatch {
+		t.Error("expected errNoMatch for BadNoMatch")
+	}
+}
+
+func TestParseNamespaceURI(t *testing.T) {
+	namespaces := []string{"http://opcfoundation.org/UA/", "urn:server", "http://www.siemens.com/simatic-s7-opcua"}
+	id, err := parseNamespaceURI("nsu=http://www.siemens.com/simatic-s7-opcua;s=Counter1", namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Namespace() != 2 || id.StringID() != "Counter1" {
+		t.Errorf("expected ns=2;s=Counter1, got ns=%d;s=%s", id.Namespace(), id.StringID())
+	}
+	if _, err := parseNamespaceURI("nsu=http://example.com/unknown;s=Counter1", namespaces); err == nil {
+		t.Error("expected an error for a namespace not in the NamespaceArray")
+	}
+	if _, err := parseNamespaceURI("nsu=http://www.siemens.com/simatic-s7-opcua", namespaces); err == nil {
+		t.Error("expected an error for a NodeId without identifier")
+	}
+	if !dependsOnNamespaces("nsu=urn:server;i=1") || !dependsOnNamespaces("/Objects") || dependsOnNamespaces("ns=3;i=1") {
+		t.Error("dependsOnNamespaces: unexpected result")
+	}
+}
@@ -0,0 +1,146 @@
+package driver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ownCertName   = "device-opcua.der"
+	ownKeyName    = "device-opcua.pem"
+	ownKeyBits    = 2048
+	ownCertExpiry = 5 * 365 * 24 * time.Hour
+)
+
+// pki is the certificate store of the driver, laid out like the usual OPC UA PKI directory:
+//
+//	own/certs, own/private   application instance certificate and key of the driver
+//	trusted/certs, trusted/crl   trusted server certificates and their revocation lists
+//	issuers/certs, issuers/crl   CA certificates to build chains, not trusted on their own
+//	rejected/certs   untrusted server certificates, for an admin to promote to trusted/certs
+type pki struct {
+	dir            string
+	applicationURI string
+}
+
+var pkiDirs = []string{
+	"own/certs", "own/private",
+	"trusted/certs", "trusted/crl",
+	"issuers/certs", "issuers/crl",
+	"rejected/certs",
+}
+
+// newPKI creates the directory layout under dir if it doesn't exist yet.
+func newPKI(dir string, applicationURI string) (*pki, error) {
+	for _, sub := range pkiDirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &pki{dir: dir, applicationURI: applicationURI}, nil
+}
+
+func (p *pki) ownCertFile() string {
+	return filepath.Join(p.dir, "own", "certs", ownCertName)
+}
+
+func (p *pki) ownKeyFile() string {
+	return filepath.Join(p.dir, "own", "private", ownKeyName)
+}
+
+// ensureOwnCertificate reuses the application instance certificate of a previous start, a new self-signed
+// one is generated when it is missing, expired or was issued for another ApplicationURI.
+func (p *pki) ensureOwnCertificate() error {
+	if cert, err := loadCertificate(p.ownCertFile()); err == nil {
+		if _, err := loadPrivateKey(p.ownKeyFile()); err == nil {
+			c, _ := x509.ParseCertificate(cert)
+			if time.Now().Before(c.NotAfter) && certificateURI(c) == p.applicationURI {
+				return nil
+			}
+		}
+	}
+	driver.Logger.Info(fmt.Sprintf("generating application instance certificate for %s in %s", p.applicationURI, p.dir))
+	return p.generateOwnCertificate()
+}
+
+func (p *pki) generateOwnCertificate() error {
+	uri, err := url.Parse(p.applicationURI)
+	if err != nil {
+		return fmt.Errorf("invalid ApplicationURI %s: %s", p.applicationURI, err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, ownKeyBits)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	notBefore := time.Now().Add(-time.Hour) // tolerate clocks of servers running a bit behind
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "device-opcua",
+			Organization: []string{"EdgeX Foundry"},
+		},
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(ownCertExpiry),
+		// OPC UA Part 6 6.2.2 requires keyCertSign on self-signed application instance certificates
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+	}
+	if host != "" {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(p.ownKeyFile(), keyPEM, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.ownCertFile(), der, 0644)
+}
+
+// applicationCertificate returns the certificate and key files a device uses for its secure channel:
+// the configured CertFile/KeyFile, or the own certificate of the driver when they are missing.
+// The ApplicationURI is taken from the certificate, since servers check that they match.
+// No certificate is returned for devices without security.
+func (p *pki) applicationCertificate(config *Configuration) (certFile string, keyFile string, applicationURI string) {
+	if config.CertFile == "" && config.KeyFile == "" {
+		if config.Policy == defaultPolicy && config.Mode == defaultMode {
+			return "", "", ""
+		}
+		return p.ownCertFile(), p.ownKeyFile(), p.applicationURI
+	}
+	applicationURI = p.applicationURI
+	if der, err := loadCertificate(config.CertFile); err == nil {
+		if c, err := x509.ParseCertificate(der); err == nil && certificateURI(c) != "" {
+			applicationURI = certificateURI(c)
+		}
+	}
+	return config.CertFile, config.KeyFile, applicationURI
+}
+
+// certificateURI returns the ApplicationURI in the SubjectAltName of c.
+func certificateURI(c *x509.Certificate) string {
+	if len(c.URIs) == 0 {
+		return ""
+	}
+	return c.URIs[0].String()
+}
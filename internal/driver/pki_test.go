@@ -0,0 +1,48 @@
+package driver
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGenerateOwnCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := newPKI(dir, "urn:test:edgex:device-opcua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.generateOwnCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	der, err := loadCertificate(p.ownCertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	if uri := certificateURI(cert); uri != "urn:test:edgex:device-opcua" {
+		t.Errorf("unexpected ApplicationURI %s", uri)
+	}
+	if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Errorf("expected keyCertSign on the self-signed certificate, got key usage %b", cert.KeyUsage)
+	}
+	if _, err := loadPrivateKey(p.ownKeyFile()); err != nil {
+		t.Fatal(err)
+	}
+
+	none := &Configuration{Policy: defaultPolicy, Mode: defaultMode}
+	if certFile, _, _ := p.applicationCertificate(none); certFile != "" {
+		t.Errorf("no certificate expected without security, got %s", certFile)
+	}
+	secure := &Configuration{Policy: "Basic256Sha256", Mode: "SignAndEncrypt"}
+	certFile, keyFile, uri := p.applicationCertificate(secure)
+	if certFile != p.ownCertFile() || keyFile != p.ownKeyFile() || uri != p.applicationURI {
+		t.Errorf("own certificate expected, got %s %s %s", certFile, keyFile, uri)
+	}
+}
@@ -3,14 +3,28 @@ package driver
 const (
 	Protocol 	= "opcua"
 
-	Address		= "Address"
+	Host		= "Host"
 	Port 		= "Port"
 	Path 		= "Path"
 	Policy 		= "Policy"
 	Mode 		= "Mode"
 	CertFile 	= "CertFile"
 	KeyFile 	= "KeyFile"
-	MappingStr 	= "Mapping"
+	Username 	= "Username"
+	Password 	= "Password"
+	UserCertFile = "UserCertFile"
+	UserKeyFile = "UserKeyFile"
+	EndpointURLRewrite = "EndpointURLRewrite"
+	EndpointURLMap = "EndpointURLMap"
+	Timestamp 	= "Timestamp"
+	Quality 	= "Quality"
+	PublishingInterval = "PublishingInterval"
+	LifetimeCount = "LifetimeCount"
+	MaxKeepAliveCount = "MaxKeepAliveCount"
+	MaxNotificationsPerPublish = "MaxNotificationsPerPublish"
+	Priority 	= "Priority"
+	MappingStr 	= "MappingStr"
 )
 
-const SubscribeCommandName  = "SubMark"
\ No newline at end of file
+const SubscribeCommandName  = "SubMark"
+const HistoryCommandName = "HistMark"
@@ -0,0 +1,78 @@
+package driver
+
+import (
+	"fmt"
+
+	sdk "github.com/edgexfoundry/device-sdk-go"
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua/ua"
+)
+
+// quality policies, selecting which values of a DataValue become readings
+const (
+	qualityGood      = "good"      // only Good values, Uncertain and Bad ones are rejected
+	qualityUncertain = "uncertain" // Good and Uncertain values, Bad ones are rejected
+
+	// qualityAttribute overrides the Quality of the device for one device resource
+	qualityAttribute = "quality"
+	// qualitySuffix names the companion reading of a device resource carrying its quality
+	qualitySuffix = "_Quality"
+)
+
+// severities of a StatusCode, the values of the companion quality readings
+const (
+	severityGood      = "Good"
+	severityUncertain = "Uncertain"
+	severityBad       = "Bad"
+)
+
+// validQualityPolicy reports an error for values other than good and uncertain.
+func validQualityPolicy(policy string) error {
+	switch policy {
+	case qualityGood, qualityUncertain:
+		return nil
+	}
+	return fmt.Errorf("invalid quality policy %s, must be %s or %s", policy, qualityGood, qualityUncertain)
+}
+
+// qualityPolicy returns the policy of a device resource: its quality attribute, or the Quality
+// of the device when it has none or an invalid one.
+func qualityPolicy(config *Configuration, attributes map[string]string) string {
+	if policy, ok := attributes[qualityAttribute]; ok && validQualityPolicy(policy) == nil {
+		return policy
+	}
+	return config.Quality
+}
+
+// severity returns Good, Uncertain or Bad from the two most significant bits of status.
+func severity(status ua.StatusCode) string {
+	switch uint32(status) >> 30 {
+	case 0:
+		return severityGood
+	case 1:
+		return severityUncertain
+	}
+	return severityBad
+}
+
+// acceptQuality reports whether a value with status becomes a reading under policy.
+func acceptQuality(status ua.StatusCode, policy string) bool {
+	switch severity(status) {
+	case severityGood:
+		return true
+	case severityUncertain:
+		return policy == qualityUncertain
+	}
+	return false
+}
+
+// qualityReading returns the companion reading with the severity of status for resource, or nil when
+// the device profile doesn't define a <resource>_Quality resource. It is also returned for rejected
+// values, so downstream can tell a Bad value from a missing one.
+func qualityReading(deviceName string, resource string, status ua.StatusCode, origin int64) *sdkModel.CommandValue {
+	name := resource + qualitySuffix
+	if _, ok := sdk.RunningService().DeviceResource(deviceName, name, "get"); !ok {
+		return nil
+	}
+	return sdkModel.NewStringValue(name, origin, severity(status))
+}
@@ -0,0 +1,30 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		status   ua.StatusCode
+		policy   string
+		severity string
+		accepted bool
+	}{
+		{ua.StatusOK, qualityGood, severityGood, true},
+		{0x00A20000, qualityGood, severityGood, true},       // GoodLocalOverride
+		{0x408F0000, qualityGood, severityUncertain, false}, // UncertainLastUsableValue
+		{0x408F0000, qualityUncertain, severityUncertain, true},
+		{ua.StatusBadNodeIDUnknown, qualityUncertain, severityBad, false},
+	}
+	for _, test := range tests {
+		if s := severity(test.status); s != test.severity {
+			t.Errorf("severity(0x%08X): expected %s, got %s", uint32(test.status), test.severity, s)
+		}
+		if accepted := acceptQuality(test.status, test.policy); accepted != test.accepted {
+			t.Errorf("acceptQuality(0x%08X, %s): expected %v, got %v", uint32(test.status), test.policy, test.accepted, accepted)
+		}
+	}
+}
@@ -11,7 +11,7 @@ import (
 func checkValueInRange(valueType sdkModel.ValueType, reading interface{}) bool {
 	isValid := false
 
-	if valueType == sdkModel.String || valueType == sdkModel.Bool {
+	if valueType == sdkModel.String || valueType == sdkModel.Bool || valueType == sdkModel.Binary {
 		return true
 	}
 
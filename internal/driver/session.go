@@ -0,0 +1,299 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// sessionManager keeps one long-lived opcua client per endpoint and security configuration.
+// The client is shared by reads, writes and subscriptions of every device pointing at it.
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*session // key is generated by sessionKey
+}
+
+// session is a connected opcua client and the devices using it.
+type session struct {
+	mu         sync.Mutex
+	client     *opcua.Client
+	limits     operationLimits
+	structures *structureCache
+	nodes      *nodeCache
+	devices    map[string]bool // guarded by the mu of the sessionManager, not of the session
+}
+
+// operationLimits are the OperationLimits of the server, 0 means no limit.
+type operationLimits struct {
+	maxNodesPerRead      uint32
+	maxNodesPerWrite     uint32
+	maxNodesPerTranslate uint32
+	maxNodesPerCall      uint32
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{sessions: make(map[string]*session)}
+}
+
+// sessionKey identifies the endpoint and security configuration of a device.
+// Devices with the same key share one session. The key is a hash, so it doesn't reveal the credentials.
+func sessionKey(config *Configuration) string {
+	identity := strings.Join([]string{
+		fmt.Sprintf("%s://%s:%s%s", config.Protocol, config.Host, config.Port, config.Path),
+		config.Policy,
+		config.Mode,
+		config.CertFile,
+		config.KeyFile,
+		config.Username,
+		config.Password,
+		config.UserCertFile,
+		config.UserKeyFile,
+		config.EndpointURLRewrite,
+		config.EndpointURLMap,
+	}, "|")
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the client for the configuration of device, connecting it first if necessary.
+func (m *sessionManager) get(deviceName string, config *Configuration) (*opcua.Client, error) {
+	key := sessionKey(config)
+	m.mu.Lock()
+	// a device whose protocol properties changed leaves its previous session
+	unused := m.detach(deviceName, key)
+	s, ok := m.sessions[key]
+	if !ok {
+		s = &session{devices: make(map[string]bool)}
+		m.sessions[key] = s
+	}
+	s.devices[deviceName] = true
+	m.mu.Unlock()
+	closeSessions(unused, deviceName)
+
+	// connect outside of the manager lock, so a slow server doesn't block the other devices
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		client, err := createClient(deviceName, config)
+		if err != nil {
+			return nil, err
+		}
+		s.client = client
+		s.limits = readOperationLimits(client)
+		s.structures = newStructureCache()
+		s.nodes = newNodeCache()
+		s.nodes.refresh(client)
+		driver.Logger.Info(fmt.Sprintf("opened OPCUA session for device=%s, limits %+v", deviceName, s.limits))
+	}
+	return s.client, nil
+}
+
+// operationLimits returns the OperationLimits of the server of config, read when the session was opened.
+func (m *sessionManager) operationLimits(config *Configuration) operationLimits {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionKey(config)]
+	m.mu.Unlock()
+	if !ok {
+		return operationLimits{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// structures returns the structured DataTypes of the server of config, nil if it isn't connected.
+func (m *sessionManager) structures(config *Configuration) *structureCache {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionKey(config)]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.structures
+}
+
+// nodes resolves the node mappings of the devices of config, nil if it isn't connected.
+func (m *sessionManager) nodes(config *Configuration) *nodeCache {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionKey(config)]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodes
+}
+
+// refreshNamespaces checks whether the NamespaceArray of the server of config changed, see nodeCache.refresh.
+// When it did, the cached DataTypes of the nodes are dropped as well. It returns the generation of the NamespaceArray.
+func (m *sessionManager) refreshNamespaces(config *Configuration, client *opcua.Client) uint64 {
+	generation, changed := m.nodes(config).refresh(client)
+	if !changed {
+		return generation
+	}
+	m.mu.Lock()
+	s, ok := m.sessions[sessionKey(config)]
+	m.mu.Unlock()
+	if ok {
+		s.mu.Lock()
+		s.structures = newStructureCache()
+		s.mu.Unlock()
+	}
+	driver.Logger.Warn(fmt.Sprintf("NamespaceArray of %s changed, resolving NodeIds again", config.Host))
+	return generation
+}
+
+// readOperationLimits reads the OperationLimits of the server. Servers which don't provide them are
+// treated as having no limit.
+func readOperationLimits(client *opcua.Client) operationLimits {
+	var limits operationLimits
+	resp, err := client.Read(&ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServerCapabilities_OperationLimits_MaxNodesPerRead), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServerCapabilities_OperationLimits_MaxNodesPerWrite), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServerCapabilities_OperationLimits_MaxNodesPerTranslateBrowsePathsToNodeIds), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServerCapabilities_OperationLimits_MaxNodesPerMethodCall), AttributeID: ua.AttributeIDValue},
+		},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+	})
+	if err != nil || len(resp.Results) != 4 {
+		return limits
+	}
+	if v, ok := limitValue(resp.Results[0]); ok {
+		limits.maxNodesPerRead = v
+	}
+	if v, ok := limitValue(resp.Results[1]); ok {
+		limits.maxNodesPerWrite = v
+	}
+	if v, ok := limitValue(resp.Results[2]); ok {
+		limits.maxNodesPerTranslate = v
+	}
+	if v, ok := limitValue(resp.Results[3]); ok {
+		limits.maxNodesPerCall = v
+	}
+	return limits
+}
+
+func limitValue(dataValue *ua.DataValue) (uint32, bool) {
+	if dataValue.Status != ua.StatusOK || dataValue.Value == nil {
+		return 0, false
+	}
+	v, ok := dataValue.Value.Value().(uint32)
+	return v, ok
+}
+
+// invalidate closes the client of config if it is still the given one, so the next get reconnects.
+// It is called when a request on the client failed at the transport or session level.
+func (m *sessionManager) invalidate(config *Configuration, client *opcua.Client) {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionKey(config)]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil && s.client == client {
+		_ = s.client.Close()
+		s.client = nil
+	}
+}
+
+// release detaches device from its session and closes the session when no device uses it anymore.
+// The session is found by device, as its protocol properties may have changed since it was opened.
+func (m *sessionManager) release(deviceName string) {
+	m.mu.Lock()
+	unused := m.detach(deviceName, "")
+	m.mu.Unlock()
+	closeSessions(unused, deviceName)
+}
+
+// move detaches device from a session of other protocol properties than config, e.g. when the device was
+// updated, so the previous session is closed if no device uses it anymore.
+func (m *sessionManager) move(deviceName string, config *Configuration) {
+	m.mu.Lock()
+	unused := m.detach(deviceName, sessionKey(config))
+	m.mu.Unlock()
+	closeSessions(unused, deviceName)
+}
+
+// detach removes device from every session but the one of key, and forgets and returns the sessions no device
+// uses anymore, to be closed by closeSessions. Caller must hold m.mu, but no session lock: a session is locked
+// while it connects, which may take until the connection times out.
+func (m *sessionManager) detach(deviceName string, key string) []*session {
+	var unused []*session
+	for k, s := range m.sessions {
+		if k == key || !s.devices[deviceName] {
+			continue
+		}
+		delete(s.devices, deviceName)
+		if len(s.devices) == 0 {
+			delete(m.sessions, k)
+			unused = append(unused, s)
+		}
+	}
+	return unused
+}
+
+// closeSessions closes the clients of sessions detached from the last device using them. Caller must not hold
+// the mu of the sessionManager.
+func closeSessions(unused []*session, deviceName string) {
+	for _, s := range unused {
+		s.mu.Lock()
+		if s.client != nil {
+			_ = s.client.Close()
+			s.client = nil
+			driver.Logger.Info(fmt.Sprintf("closed OPCUA session of device=%s", deviceName))
+		}
+		s.mu.Unlock()
+	}
+}
+
+// closeAll closes every open session, it is used when the driver stops.
+func (m *sessionManager) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, s := range m.sessions {
+		s.mu.Lock()
+		if s.client != nil {
+			_ = s.client.Close()
+		}
+		s.mu.Unlock()
+		delete(m.sessions, key)
+	}
+}
+
+// serviceError is returned when an OPCUA service call itself failed, as opposed to one of its results.
+type serviceError struct {
+	service string
+	err     error
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.service, e.err)
+}
+
+// broken reports whether the failure means the session or the secure channel can't be used anymore.
+func (e *serviceError) broken() bool {
+	status, ok := e.err.(ua.StatusCode)
+	if !ok {
+		// transport failures like io.EOF or a closed secure channel
+		return true
+	}
+	switch status {
+	case ua.StatusBadSessionIDInvalid, ua.StatusBadSessionClosed, ua.StatusBadSessionNotActivated,
+		ua.StatusBadSecureChannelIDInvalid, ua.StatusBadSecureChannelClosed, ua.StatusBadConnectionClosed,
+		ua.StatusBadServerNotConnected, ua.StatusBadCommunicationError, ua.StatusBadTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionMove(t *testing.T) {
+	old := &Configuration{Protocol: "opc.tcp", Host: "old", Port: "4840", Policy: "None", Mode: "None"}
+	shared := &Configuration{Protocol: "opc.tcp", Host: "shared", Port: "4840", Policy: "None", Mode: "None"}
+	updated := &Configuration{Protocol: "opc.tcp", Host: "new", Port: "4840", Policy: "None", Mode: "None"}
+	m := &sessionManager{sessions: map[string]*session{
+		sessionKey(old):    {devices: map[string]bool{"device1": true}},
+		sessionKey(shared): {devices: map[string]bool{"device2": true, "device3": true}},
+	}}
+
+	m.move("device1", updated)
+	if _, ok := m.sessions[sessionKey(old)]; ok {
+		t.Error("expected the session of the previous config to be closed")
+	}
+	m.move("device2", updated)
+	s, ok := m.sessions[sessionKey(shared)]
+	if !ok {
+		t.Fatal("expected the session still used by device3 to stay open")
+	}
+	if s.devices["device2"] || !s.devices["device3"] {
+		t.Errorf("expected only device3 in the shared session, got %v", s.devices)
+	}
+	m.move("device3", shared)
+	if _, ok := m.sessions[sessionKey(shared)]; !ok {
+		t.Error("expected the session of an unchanged config to stay open")
+	}
+
+	m.release("device3")
+	if len(m.sessions) != 0 {
+		t.Errorf("expected no sessions after release, got %d", len(m.sessions))
+	}
+}
+
+func TestSessionMoveWhileConnecting(t *testing.T) {
+	old := &Configuration{Protocol: "opc.tcp", Host: "old", Port: "4840", Policy: "None", Mode: "None"}
+	slow := &Configuration{Protocol: "opc.tcp", Host: "unreachable", Port: "4840", Policy: "None", Mode: "None"}
+	connecting := &session{devices: map[string]bool{"device2": true}}
+	m := &sessionManager{sessions: map[string]*session{
+		sessionKey(old):  {devices: map[string]bool{"device1": true}},
+		sessionKey(slow): connecting,
+	}}
+	// a session is locked while it connects to its server
+	connecting.mu.Lock()
+	defer connecting.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.move("device1", &Configuration{Protocol: "opc.tcp", Host: "new", Port: "4840", Policy: "None", Mode: "None"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("moving a device waited for another session connecting")
+	}
+	if _, ok := m.sessions[sessionKey(old)]; ok {
+		t.Error("expected the session of the previous config to be closed")
+	}
+}
+
+func TestSessionKeyHidesPassword(t *testing.T) {
+	config := &Configuration{Protocol: "opc.tcp", Host: "plc", Port: "4840", Username: "operator", Password: "secret"}
+	key := sessionKey(config)
+	if strings.Contains(key, "secret") {
+		t.Errorf("session key %s contains the password", key)
+	}
+	other := *config
+	other.Password = "changed"
+	if sessionKey(&other) == key {
+		t.Error("expected another session key for another password")
+	}
+}
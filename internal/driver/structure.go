@@ -0,0 +1,773 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/spf13/cast"
+)
+
+// structureKind is the encoding of a structure, as StructureType of a StructureDefinition
+type structureKind int
+
+const (
+	structurePlain    structureKind = iota // all fields are encoded
+	structureOptional                      // a mask of the optional fields present precedes the fields
+	structureUnion                         // a switch selects the one field encoded
+)
+
+// structure describes the binary encoding of a structured DataType, read from its DataTypeDefinition
+// or from the legacy DataTypeDictionary of the server.
+type structure struct {
+	name   string
+	kind   structureKind
+	fields []*structureField
+}
+
+// structureField is one field of a structure. lengthField, switchField, switchValue and bits are
+// only set for structures of a legacy DataTypeDictionary.
+type structureField struct {
+	name        string
+	typ         *fieldType
+	array       bool   // an Int32 length precedes the elements
+	optional    bool   // present when its bit is set in the mask of a structureOptional
+	lengthField string // the preceding field holding the number of elements of the array
+	switchField string // the preceding field deciding whether this field is present
+	switchValue *int64 // the value of switchField selecting this field, any non zero value if nil
+	bits        int    // a bit field of this length, part of the encoding and not shown in JSON
+	hidden      bool   // a length or switch field of another field, not shown in JSON
+}
+
+// fieldType is the type of a field, a built-in type or a nested structure.
+type fieldType struct {
+	builtin   ua.TypeID
+	structure *structure
+}
+
+// link marks the fields other fields refer to as hidden. It must be called once all fields are added.
+func (s *structure) link() {
+	for _, f := range s.fields {
+		for _, other := range s.fields {
+			if other.lengthField == f.name || other.switchField == f.name {
+				f.hidden = true
+			}
+		}
+	}
+}
+
+// jsonObject is a JSON object keeping the order of the structure fields.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeStructure decodes the binary body of an ExtensionObject of s into JSON.
+func decodeStructure(s *structure, body []byte) (string, error) {
+	r := &binaryReader{b: body}
+	v, err := s.decode(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %s", s.name, err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// encodeStructure encodes a JSON object into the binary body of an ExtensionObject of s.
+func encodeStructure(s *structure, value string) ([]byte, error) {
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %s", err)
+	}
+	w := &binaryWriter{}
+	if err := s.encode(w, v); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %s", s.name, err)
+	}
+	return w.bytes(), nil
+}
+
+func (s *structure) decode(r *binaryReader) (interface{}, error) {
+	var mask uint32
+	switch s.kind {
+	case structureUnion:
+		sw, err := r.uint32()
+		if err != nil || sw == 0 {
+			return nil, err
+		}
+		if int(sw) > len(s.fields) {
+			return nil, fmt.Errorf("invalid union switch %d", sw)
+		}
+		f := s.fields[sw-1]
+		v, err := f.decode(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{{f.name, v}}, nil
+	case structureOptional:
+		var err error
+		if mask, err = r.uint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	obj := make(jsonObject, 0, len(s.fields))
+	vals := make(map[string]int64) // values of the hidden fields
+	optional := uint(0)
+	for _, f := range s.fields {
+		if f.optional {
+			present := mask&(1<<optional) != 0
+			optional++
+			if !present {
+				continue
+			}
+		}
+		if !f.switched(vals) {
+			continue
+		}
+		if f.bits > 0 {
+			v, err := r.readBits(f.bits)
+			if err != nil {
+				return nil, err
+			}
+			vals[f.name] = v
+			continue
+		}
+		r.align()
+		v, err := f.decode(r, vals)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", f.name, err)
+		}
+		if f.hidden {
+			vals[f.name] = cast.ToInt64(v)
+			continue
+		}
+		obj = append(obj, jsonMember{f.name, v})
+	}
+	r.align()
+	return obj, nil
+}
+
+// switched reports whether f is present according to its switch field.
+func (f *structureField) switched(vals map[string]int64) bool {
+	if f.switchField == "" {
+		return true
+	}
+	if f.switchValue != nil {
+		return vals[f.switchField] == *f.switchValue
+	}
+	return vals[f.switchField] != 0
+}
+
+// decode reads the value of f, an array of its type if it is one.
+func (f *structureField) decode(r *binaryReader, vals map[string]int64) (interface{}, error) {
+	if !f.array && f.lengthField == "" {
+		return f.typ.decode(r)
+	}
+	var n int64
+	if f.lengthField != "" {
+		n = vals[f.lengthField]
+	} else {
+		l, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		n = int64(int32(l))
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	if n > int64(len(r.b)-r.pos) {
+		return nil, fmt.Errorf("invalid array length %d", n)
+	}
+	values := make([]interface{}, 0, n)
+	for i := int64(0); i < n; i++ {
+		v, err := f.typ.decode(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (t *fieldType) decode(r *binaryReader) (interface{}, error) {
+	if t.structure != nil {
+		return t.structure.decode(r)
+	}
+	return r.builtin(t.builtin)
+}
+
+func (s *structure) encode(w *binaryWriter, value interface{}) error {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		if value == nil && s.kind == structureUnion {
+			return w.uint32(0)
+		}
+		return fmt.Errorf("%v is no JSON object", value)
+	}
+	switch s.kind {
+	case structureUnion:
+		for i, f := range s.fields {
+			if v, ok := m[f.name]; ok {
+				if err := w.uint32(uint32(i + 1)); err != nil {
+					return err
+				}
+				return f.encode(w, v)
+			}
+		}
+		return w.uint32(0)
+	case structureOptional:
+		var mask uint32
+		optional := uint(0)
+		for _, f := range s.fields {
+			if f.optional {
+				if _, ok := m[f.name]; ok {
+					mask |= 1 << optional
+				}
+				optional++
+			}
+		}
+		if err := w.uint32(mask); err != nil {
+			return err
+		}
+	}
+
+	// the hidden fields follow from the fields present
+	vals := make(map[string]int64)
+	for _, f := range s.fields {
+		v, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		if f.lengthField != "" {
+			values, _ := v.([]interface{})
+			vals[f.lengthField] = int64(len(values))
+		}
+		if f.switchField != "" {
+			vals[f.switchField] = 1
+			if f.switchValue != nil {
+				vals[f.switchField] = *f.switchValue
+			}
+		}
+	}
+
+	for _, f := range s.fields {
+		v, present := m[f.name]
+		if f.optional && !present {
+			continue
+		}
+		if !f.switched(vals) {
+			continue
+		}
+		if f.bits > 0 {
+			w.writeBits(vals[f.name], f.bits)
+			continue
+		}
+		w.align()
+		if f.hidden {
+			v = vals[f.name]
+		} else if !present {
+			return fmt.Errorf("missing field %s", f.name)
+		}
+		if err := f.encode(w, v); err != nil {
+			return fmt.Errorf("field %s: %s", f.name, err)
+		}
+	}
+	w.align()
+	return nil
+}
+
+// encode writes the value of f, an array of its type if it is one.
+func (f *structureField) encode(w *binaryWriter, value interface{}) error {
+	if !f.array && f.lengthField == "" {
+		return f.typ.encode(w, value)
+	}
+	values, ok := value.([]interface{})
+	if !ok && value != nil {
+		return fmt.Errorf("%v is no JSON array", value)
+	}
+	if f.lengthField == "" {
+		n := int32(len(values))
+		if value == nil {
+			n = -1
+		}
+		if err := w.uint32(uint32(n)); err != nil {
+			return err
+		}
+	}
+	for _, v := range values {
+		if err := f.typ.encode(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *fieldType) encode(w *binaryWriter, value interface{}) error {
+	if t.structure != nil {
+		return t.structure.encode(w, value)
+	}
+	return w.builtin(t.builtin, value)
+}
+
+// binaryReader reads the OPC UA binary encoding, bit fields are read from the least significant bit.
+type binaryReader struct {
+	b     []byte
+	pos   int
+	cur   byte // current byte of bit fields
+	nbits uint // bits left in cur
+}
+
+func (r *binaryReader) read(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.b) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *binaryReader) uint32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *binaryReader) readBits(n int) (int64, error) {
+	var v int64
+	for i := 0; i < n; i++ {
+		if r.nbits == 0 {
+			b, err := r.read(1)
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.nbits = b[0], 8
+		}
+		v |= int64(r.cur&1) << uint(i)
+		r.cur >>= 1
+		r.nbits--
+	}
+	return v, nil
+}
+
+// align skips the rest of a partially read bit field byte.
+func (r *binaryReader) align() {
+	r.nbits = 0
+}
+
+// bytes reads a String or ByteString, nil for the null value.
+func (r *binaryReader) bytes() ([]byte, error) {
+	l, err := r.uint32()
+	if err != nil || int32(l) < 0 {
+		return nil, err
+	}
+	return r.read(int(l))
+}
+
+// decoder is implemented by the types of the opcua library
+type decoder interface {
+	Decode(b []byte) (int, error)
+}
+
+func (r *binaryReader) decodeWith(v decoder) error {
+	n, err := v.Decode(r.b[r.pos:])
+	if err != nil {
+		return err
+	}
+	r.pos += n
+	return nil
+}
+
+// builtin reads a value of a built-in type, converted into a value JSON can represent.
+func (r *binaryReader) builtin(t ua.TypeID) (interface{}, error) {
+	switch t {
+	case ua.TypeIDBoolean, ua.TypeIDSByte, ua.TypeIDByte:
+		b, err := r.read(1)
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case ua.TypeIDBoolean:
+			return b[0] != 0, nil
+		case ua.TypeIDSByte:
+			return int8(b[0]), nil
+		}
+		return b[0], nil
+	case ua.TypeIDInt16, ua.TypeIDUint16:
+		b, err := r.read(2)
+		if err != nil {
+			return nil, err
+		}
+		if t == ua.TypeIDInt16 {
+			return int16(binary.LittleEndian.Uint16(b)), nil
+		}
+		return binary.LittleEndian.Uint16(b), nil
+	case ua.TypeIDInt32, ua.TypeIDUint32, ua.TypeIDStatusCode, ua.TypeIDFloat:
+		v, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case ua.TypeIDInt32:
+			return int32(v), nil
+		case ua.TypeIDFloat:
+			return math.Float32frombits(v), nil
+		}
+		return v, nil
+	case ua.TypeIDInt64, ua.TypeIDUint64, ua.TypeIDDouble, ua.TypeIDDateTime:
+		b, err := r.read(8)
+		if err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint64(b)
+		switch t {
+		case ua.TypeIDInt64:
+			return int64(v), nil
+		case ua.TypeIDDouble:
+			return math.Float64frombits(v), nil
+		case ua.TypeIDDateTime:
+			if v == 0 {
+				return nil, nil
+			}
+			return ticksToTime(int64(v)).Format(time.RFC3339Nano), nil
+		}
+		return v, nil
+	case ua.TypeIDString, ua.TypeIDXMLElement:
+		b, err := r.bytes()
+		if err != nil || b == nil {
+			return nil, err
+		}
+		return string(b), nil
+	case ua.TypeIDByteString:
+		return r.bytes()
+	case ua.TypeIDGUID:
+		b, err := r.read(16)
+		if err != nil {
+			return nil, err
+		}
+		return formatGUID(b), nil
+	case ua.TypeIDQualifiedName:
+		b, err := r.read(2)
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return jsonObject{{"NamespaceIndex", binary.LittleEndian.Uint16(b)}, {"Name", string(name)}}, nil
+	case ua.TypeIDLocalizedText:
+		mask, err := r.read(1)
+		if err != nil {
+			return nil, err
+		}
+		var locale, text []byte
+		if mask[0]&0x1 != 0 {
+			if locale, err = r.bytes(); err != nil {
+				return nil, err
+			}
+		}
+		if mask[0]&0x2 != 0 {
+			if text, err = r.bytes(); err != nil {
+				return nil, err
+			}
+		}
+		return jsonObject{{"Locale", string(locale)}, {"Text", string(text)}}, nil
+	case ua.TypeIDNodeID:
+		v := new(ua.NodeID)
+		if err := r.decodeWith(v); err != nil {
+			return nil, err
+		}
+		return v.String(), nil
+	case ua.TypeIDExpandedNodeID:
+		v := new(ua.ExpandedNodeID)
+		if err := r.decodeWith(v); err != nil {
+			return nil, err
+		}
+		return v.String(), nil
+	case ua.TypeIDVariant:
+		v := new(ua.Variant)
+		if err := r.decodeWith(v); err != nil {
+			return nil, err
+		}
+		return v.Value(), nil
+	case ua.TypeIDDataValue:
+		v := new(ua.DataValue)
+		err := r.decodeWith(v)
+		return v, err
+	case ua.TypeIDDiagnosticInfo:
+		v := new(ua.DiagnosticInfo)
+		err := r.decodeWith(v)
+		return v, err
+	case ua.TypeIDExtensionObject:
+		v := new(ua.ExtensionObject)
+		if err := r.decodeWith(v); err != nil {
+			return nil, err
+		}
+		return v.Value, nil
+	}
+	return nil, fmt.Errorf("unsupported built-in type %d", t)
+}
+
+// binaryWriter writes the OPC UA binary encoding, bit fields are written from the least significant bit.
+type binaryWriter struct {
+	buf   bytes.Buffer
+	cur   byte // pending byte of bit fields
+	nbits uint // bits used in cur
+}
+
+func (w *binaryWriter) bytes() []byte {
+	w.align()
+	return w.buf.Bytes()
+}
+
+func (w *binaryWriter) uint32(v uint32) error {
+	return binary.Write(&w.buf, binary.LittleEndian, v)
+}
+
+func (w *binaryWriter) writeBits(v int64, n int) {
+	for i := 0; i < n; i++ {
+		w.cur |= byte(v>>uint(i)&1) << w.nbits
+		w.nbits++
+		if w.nbits == 8 {
+			w.align()
+		}
+	}
+}
+
+// align writes a partially filled bit field byte.
+func (w *binaryWriter) align() {
+	if w.nbits > 0 {
+		w.buf.WriteByte(w.cur)
+		w.cur, w.nbits = 0, 0
+	}
+}
+
+// writeBytes writes a String or ByteString, nil as the null value.
+func (w *binaryWriter) writeBytes(b []byte) error {
+	if b == nil {
+		return w.uint32(math.MaxUint32)
+	}
+	if err := w.uint32(uint32(len(b))); err != nil {
+		return err
+	}
+	_, err := w.buf.Write(b)
+	return err
+}
+
+// encoder is implemented by the types of the opcua library
+type encoder interface {
+	Encode() ([]byte, error)
+}
+
+func (w *binaryWriter) encodeWith(v encoder) error {
+	b, err := v.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(b)
+	return err
+}
+
+// builtin writes a JSON value as a value of a built-in type.
+func (w *binaryWriter) builtin(t ua.TypeID, value interface{}) error {
+	if n, ok := value.(json.Number); ok {
+		value = n.String()
+	}
+	var v interface{}
+	var err error
+	switch t {
+	case ua.TypeIDBoolean:
+		var b bool
+		b, err = cast.ToBoolE(value)
+		v = uint8(0)
+		if b {
+			v = uint8(1)
+		}
+	case ua.TypeIDSByte:
+		v, err = cast.ToInt8E(value)
+	case ua.TypeIDByte:
+		v, err = cast.ToUint8E(value)
+	case ua.TypeIDInt16:
+		v, err = cast.ToInt16E(value)
+	case ua.TypeIDUint16:
+		v, err = cast.ToUint16E(value)
+	case ua.TypeIDInt32:
+		v, err = cast.ToInt32E(value)
+	case ua.TypeIDUint32, ua.TypeIDStatusCode:
+		v, err = cast.ToUint32E(value)
+	case ua.TypeIDInt64:
+		v, err = cast.ToInt64E(value)
+	case ua.TypeIDUint64:
+		v, err = cast.ToUint64E(value)
+	case ua.TypeIDFloat:
+		v, err = cast.ToFloat32E(value)
+	case ua.TypeIDDouble:
+		v, err = cast.ToFloat64E(value)
+	case ua.TypeIDDateTime:
+		var ticks int64
+		if value != nil {
+			tm, err := time.Parse(time.RFC3339Nano, cast.ToString(value))
+			if err != nil {
+				return err
+			}
+			ticks = timeToTicks(tm)
+		}
+		v = ticks
+	case ua.TypeIDString, ua.TypeIDXMLElement:
+		if value == nil {
+			return w.writeBytes(nil)
+		}
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return err
+		}
+		return w.writeBytes([]byte(s))
+	case ua.TypeIDByteString:
+		if value == nil {
+			return w.writeBytes(nil)
+		}
+		b, err := base64.StdEncoding.DecodeString(cast.ToString(value))
+		if err != nil {
+			return err
+		}
+		return w.writeBytes(b)
+	case ua.TypeIDGUID:
+		b, err := parseGUID(cast.ToString(value))
+		if err != nil {
+			return err
+		}
+		_, err = w.buf.Write(b)
+		return err
+	case ua.TypeIDQualifiedName:
+		m, _ := value.(map[string]interface{})
+		ns, err := cast.ToUint16E(jsonString(m["NamespaceIndex"]))
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(&w.buf, binary.LittleEndian, ns); err != nil {
+			return err
+		}
+		return w.writeBytes([]byte(cast.ToString(m["Name"])))
+	case ua.TypeIDLocalizedText:
+		m, _ := value.(map[string]interface{})
+		var mask byte
+		locale, hasLocale := m["Locale"].(string)
+		text, hasText := m["Text"].(string)
+		if hasLocale && locale != "" {
+			mask |= 0x1
+		}
+		if hasText {
+			mask |= 0x2
+		}
+		w.buf.WriteByte(mask)
+		if mask&0x1 != 0 {
+			if err := w.writeBytes([]byte(locale)); err != nil {
+				return err
+			}
+		}
+		if mask&0x2 != 0 {
+			return w.writeBytes([]byte(text))
+		}
+		return nil
+	case ua.TypeIDNodeID:
+		id, err := ua.ParseNodeID(cast.ToString(value))
+		if err != nil {
+			return err
+		}
+		return w.encodeWith(id)
+	case ua.TypeIDExpandedNodeID:
+		id, err := ua.ParseExpandedNodeID(cast.ToString(value), nil)
+		if err != nil {
+			return err
+		}
+		return w.encodeWith(id)
+	default:
+		return fmt.Errorf("writing built-in type %d is not supported", t)
+	}
+	if err != nil {
+		return err
+	}
+	return binary.Write(&w.buf, binary.LittleEndian, v)
+}
+
+// jsonString returns the text of a json.Number, for cast to parse it.
+func jsonString(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return v
+}
+
+// ticksOffset is the number of 100 ns intervals from 1601-01-01, the epoch of DateTime, to 1970-01-01.
+const ticksOffset = 116444736000000000
+
+func ticksToTime(ticks int64) time.Time {
+	ticks -= ticksOffset
+	return time.Unix(ticks/1e7, ticks%1e7*100).UTC()
+}
+
+func timeToTicks(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()*1e7 + int64(t.Nanosecond())/100 + ticksOffset
+}
+
+// formatGUID formats the binary encoding of a Guid, whose first three groups are little endian.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]), b[8:10], b[10:16])
+}
+
+func parseGUID(s string) ([]byte, error) {
+	var d1 uint32
+	var d2, d3 uint16
+	var d4, d5 []byte
+	if _, err := fmt.Sscanf(strings.Replace(s, "-", " ", -1), "%x %x %x %x %x", &d1, &d2, &d3, &d4, &d5); err != nil ||
+		len(d4) != 2 || len(d5) != 6 {
+		return nil, fmt.Errorf("invalid Guid %s", s)
+	}
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint32(b[0:4], d1)
+	binary.LittleEndian.PutUint16(b[4:6], d2)
+	binary.LittleEndian.PutUint16(b[6:8], d3)
+	copy(b[8:10], d4)
+	copy(b[10:16], d5)
+	return b, nil
+}
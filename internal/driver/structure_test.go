@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestStructureRoundTrip(t *testing.T) {
+	euRange := &structure{name: "Range", fields: []*structureField{
+		{name: "Low", typ: &fieldType{builtin: ua.TypeIDDouble}},
+		{name: "High", typ: &fieldType{builtin: ua.TypeIDDouble}},
+	}}
+	s := &structure{name: "Motor", kind: structureOptional, fields: []*structureField{
+		{name: "Name", typ: &fieldType{builtin: ua.TypeIDString}},
+		{name: "Speed", typ: &fieldType{builtin: ua.TypeIDFloat}},
+		{name: "Running", typ: &fieldType{builtin: ua.TypeIDBoolean}},
+		{name: "Samples", typ: &fieldType{builtin: ua.TypeIDInt16}, array: true},
+		{name: "Range", typ: &fieldType{structure: euRange}},
+		{name: "Comment", typ: &fieldType{builtin: ua.TypeIDLocalizedText}, optional: true},
+		{name: "Started", typ: &fieldType{builtin: ua.TypeIDDateTime}, optional: true},
+	}}
+
+	value := `{"Name":"M1","Speed":1.5,"Running":true,"Samples":[1,-2,3],"Range":{"Low":0,"High":100},` +
+		`"Started":"2020-03-01T12:00:00.5Z"}`
+	body, err := encodeStructure(s, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeStructure(s, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != value {
+		t.Errorf("expected %s, got %s", value, decoded)
+	}
+	if _, err := decodeStructure(s, body[:len(body)-1]); err == nil {
+		t.Errorf("expected an error for a truncated body")
+	}
+	if _, err := encodeStructure(s, `{"Name":"M1"}`); err == nil {
+		t.Errorf("expected an error for missing fields")
+	}
+}
+
+func TestStructureUnion(t *testing.T) {
+	s := &structure{name: "Setpoint", kind: structureUnion, fields: []*structureField{
+		{name: "Value", typ: &fieldType{builtin: ua.TypeIDDouble}},
+		{name: "Text", typ: &fieldType{builtin: ua.TypeIDString}},
+	}}
+	body, err := encodeStructure(s, `{"Text":"auto"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{2, 0, 0, 0, 4, 0, 0, 0, 'a', 'u', 't', 'o'}
+	if !bytes.Equal(body, expected) {
+		t.Errorf("expected % x, got % x", expected, body)
+	}
+	if decoded, _ := decodeStructure(s, body); decoded != `{"Text":"auto"}` {
+		t.Errorf("unexpected union %s", decoded)
+	}
+}
+
+const testDictionary = `<opc:TypeDictionary xmlns:opc="http://opcfoundation.org/BinarySchema/"
+    xmlns:ua="http://opcfoundation.org/UA/" xmlns:tns="urn:plc:udt" TargetNamespace="urn:plc:udt">
+  <opc:Import Namespace="http://opcfoundation.org/UA/"/>
+  <opc:EnumeratedType Name="Mode" LengthInBits="32"/>
+  <opc:StructuredType Name="Point" BaseType="ua:ExtensionObject">
+    <opc:Field Name="X" TypeName="opc:Float"/>
+    <opc:Field Name="Y" TypeName="opc:Float"/>
+  </opc:StructuredType>
+  <opc:StructuredType Name="Axis" BaseType="ua:ExtensionObject">
+    <opc:Field Name="CommentSpecified" TypeName="opc:Bit"/>
+    <opc:Field Name="Reserved1" TypeName="opc:Bit" Length="31"/>
+    <opc:Field Name="Mode" TypeName="tns:Mode"/>
+    <opc:Field Name="NoOfPoints" TypeName="opc:Int32"/>
+    <opc:Field Name="Points" TypeName="tns:Point" LengthField="NoOfPoints"/>
+    <opc:Field Name="Comment" TypeName="ua:LocalizedText" SwitchField="CommentSpecified"/>
+  </opc:StructuredType>
+</opc:TypeDictionary>`
+
+func TestParseDictionary(t *testing.T) {
+	structures, err := parseDictionary([]byte(testDictionary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	axis, ok := structures["Axis"]
+	if !ok {
+		t.Fatalf("Axis not found in %v", structures)
+	}
+
+	for _, value := range []string{
+		`{"Mode":2,"Points":[{"X":1,"Y":2},{"X":3.5,"Y":-1}],"Comment":{"Locale":"en","Text":"left"}}`,
+		`{"Mode":0,"Points":[]}`,
+	} {
+		body, err := encodeStructure(axis, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeStructure(axis, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != value {
+			t.Errorf("expected %s, got %s", value, decoded)
+		}
+	}
+
+	if _, err := parseDictionary([]byte(`<opc:TypeDictionary xmlns:opc="http://opcfoundation.org/BinarySchema/">
+  <opc:StructuredType Name="A"><opc:Field Name="B" TypeName="opc:Unknown"/></opc:StructuredType>
+</opc:TypeDictionary>`)); err == nil {
+		t.Errorf("expected an error for an unknown type")
+	}
+}
+
+func TestGUID(t *testing.T) {
+	guid := "72962B91-FA75-4AE6-8D28-B404DC7DAF63"
+	b, err := parseGUID(guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 0x91 || b[8] != 0x8D {
+		t.Errorf("unexpected encoding % x", b)
+	}
+	if s := formatGUID(b); s != guid {
+		t.Errorf("expected %s, got %s", guid, s)
+	}
+}
@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gopcua/opcua"
+)
+
+// subscriptionParameters returns the parameters of the subscription of a device from its protocol properties.
+// Empty counts are left to the opcua library, a Priority of 0 is the lowest.
+func subscriptionParameters(config *Configuration) (*opcua.SubscriptionParameters, error) {
+	interval, err := time.ParseDuration(config.PublishingInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid %s %s, must be a duration like 500ms", PublishingInterval, config.PublishingInterval)
+	}
+	params := &opcua.SubscriptionParameters{Interval: interval}
+	if params.LifetimeCount, err = parseCount(LifetimeCount, config.LifetimeCount); err != nil {
+		return nil, err
+	}
+	if params.MaxKeepAliveCount, err = parseCount(MaxKeepAliveCount, config.MaxKeepAliveCount); err != nil {
+		return nil, err
+	}
+	if params.MaxNotificationsPerPublish, err = parseCount(MaxNotificationsPerPublish, config.MaxNotificationsPerPublish); err != nil {
+		return nil, err
+	}
+	if config.Priority != "" {
+		priority, err := strconv.ParseUint(config.Priority, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s, must be between 0 and 255", Priority, config.Priority)
+		}
+		params.Priority = uint8(priority)
+	}
+	if params.LifetimeCount != 0 && params.MaxKeepAliveCount != 0 && params.LifetimeCount < 3*params.MaxKeepAliveCount {
+		return nil, fmt.Errorf("%s %d must be at least 3 times %s %d", LifetimeCount, params.LifetimeCount,
+			MaxKeepAliveCount, params.MaxKeepAliveCount)
+	}
+	return params, nil
+}
+
+// parseCount parses the protocol property name, empty means 0.
+func parseCount(name, value string) (uint32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", name, value)
+	}
+	return uint32(n), nil
+}
@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionParameters(t *testing.T) {
+	config := &Configuration{PublishingInterval: "250ms", LifetimeCount: "30", MaxKeepAliveCount: "10",
+		MaxNotificationsPerPublish: "100", Priority: "5"}
+	params, err := subscriptionParameters(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Interval != 250*time.Millisecond || params.LifetimeCount != 30 || params.MaxKeepAliveCount != 10 ||
+		params.MaxNotificationsPerPublish != 100 || params.Priority != 5 {
+		t.Errorf("unexpected parameters %+v", *params)
+	}
+
+	params, err = subscriptionParameters(&Configuration{PublishingInterval: defaultPublishingInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Interval != 500*time.Millisecond || params.LifetimeCount != 0 || params.MaxKeepAliveCount != 0 {
+		t.Errorf("unexpected default parameters %+v", *params)
+	}
+
+	for _, invalid := range []Configuration{
+		{PublishingInterval: "0s"},
+		{PublishingInterval: "fast"},
+		{PublishingInterval: "1s", LifetimeCount: "-1"},
+		{PublishingInterval: "1s", Priority: "256"},
+		{PublishingInterval: "1s", LifetimeCount: "20", MaxKeepAliveCount: "10"},
+	} {
+		if _, err := subscriptionParameters(&invalid); err == nil {
+			t.Errorf("subscriptionParameters(%+v): expected an error", invalid)
+		}
+	}
+}
+
+func TestSameSubscription(t *testing.T) {
+	config := Configuration{Protocol: "opc.tcp", Host: "localhost", Port: "4840", PublishingInterval: "500ms"}
+	cms := &CMS{config: &config}
+	policy := config
+	policy.Timestamp = "server"
+	if !cms.sameSubscription(&policy) {
+		t.Error("expected the subscription to be kept when only the timestamp policy changes")
+	}
+	interval := config
+	interval.PublishingInterval = "1s"
+	if cms.sameSubscription(&interval) {
+		t.Error("expected a new subscription when the publishing interval changes")
+	}
+	host := config
+	host.Host = "plc"
+	if cms.sameSubscription(&host) {
+		t.Error("expected a new subscription when the session changes")
+	}
+}
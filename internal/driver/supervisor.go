@@ -0,0 +1,231 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	sdkModel "github.com/edgexfoundry/device-sdk-go/pkg/models"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// backoff computes exponentially growing reconnect delays with random jitter.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	jitter  float64
+	attempt uint
+}
+
+func newBackoff(config *DriverConfig) (*backoff, error) {
+	min, err := time.ParseDuration(config.ReconnectMinInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ReconnectMinInterval %s: %s", config.ReconnectMinInterval, err)
+	}
+	max, err := time.ParseDuration(config.ReconnectMaxInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ReconnectMaxInterval %s: %s", config.ReconnectMaxInterval, err)
+	}
+	jitter, err := strconv.ParseFloat(config.ReconnectJitter, 64)
+	if err != nil || jitter < 0 || jitter > 1 {
+		return nil, fmt.Errorf("invalid ReconnectJitter %s, must be between 0 and 1", config.ReconnectJitter)
+	}
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("invalid reconnect interval [%s, %s]", min, max)
+	}
+	return &backoff{min: min, max: max, jitter: jitter}, nil
+}
+
+// next returns the delay before the next attempt, doubling it every call until max is reached.
+func (b *backoff) next() time.Duration {
+	d := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		d = b.min << b.attempt
+		b.attempt++
+	}
+	if b.jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * b.jitter * float64(d))
+	}
+	return d
+}
+
+// reset starts over from min after a successful attempt.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// supervise keeps the subscription of cms alive until ctx is done. A broken session is reconnected
+// with exponential backoff and the subscription is restored with the same node set.
+func (cms *CMS) supervise(ctx context.Context) {
+	b, _ := newBackoff(driver.Config) // validated in Initialize
+	var lostID uint32                 // subscription of the broken session, to be transferred
+	for {
+		driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=connecting", cms.deviceName))
+		err := cms.restore(lostID)
+		if err == nil {
+			b.reset()
+			driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=subscribed", cms.deviceName))
+			err = cms.listen(ctx)
+		}
+
+		cms.mu.Lock()
+		client, sub, config := cms.client, cms.sub, cms.config
+		cms.sub = nil
+		cms.mu.Unlock()
+		lostID = 0
+		if ctx.Err() != nil {
+			if sub != nil {
+				_ = sub.Cancel()
+			}
+			driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=stopped", cms.deviceName))
+			return
+		}
+
+		driver.Logger.Warn(fmt.Sprintf("[Supervisor] device=%s state=disconnected: %s", cms.deviceName, err))
+		if se, ok := err.(*serviceError); ok && !se.broken() {
+			// the session is fine, only the subscription failed, so start over with a new one
+			if sub != nil {
+				_ = sub.Cancel()
+			}
+		} else {
+			if sub != nil {
+				lostID = sub.SubscriptionID
+			}
+			if client != nil {
+				sessions.invalidate(config, client)
+			}
+		}
+
+		wait := b.next()
+		driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=reconnecting in %s", cms.deviceName, wait))
+		select {
+		case <-ctx.Done():
+			driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=stopped", cms.deviceName))
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// restore connects the session of cms and subscribes its nodes. When lostID is not 0
+// the notifications of the lost subscription are recovered first.
+func (cms *CMS) restore(lostID uint32) error {
+	cms.mu.Lock()
+	config := cms.config
+	cms.mu.Unlock()
+	client, err := sessions.get(cms.deviceName, config)
+	if err != nil {
+		return err
+	}
+	if lostID != 0 {
+		cms.recover(client, lostID)
+	}
+	cms.mu.Lock()
+	defer cms.mu.Unlock()
+	return cms.subscribe(client)
+}
+
+// recover transfers the subscription id of a broken session to client and republishes the
+// notifications the server still keeps for it, so no data change of the outage is lost.
+// The transferred subscription is deleted afterwards, since the opcua library can only
+// publish on subscriptions it created itself.
+func (cms *CMS) recover(client *opcua.Client, id uint32) {
+	var available []uint32
+	err := client.Send(&ua.TransferSubscriptionsRequest{SubscriptionIDs: []uint32{id}}, func(v interface{}) error {
+		resp, ok := v.(*ua.TransferSubscriptionsResponse)
+		if !ok || len(resp.Results) == 0 {
+			return fmt.Errorf("unexpected response %T", v)
+		}
+		if resp.Results[0].StatusCode != ua.StatusOK {
+			return resp.Results[0].StatusCode
+		}
+		available = resp.Results[0].AvailableSequenceNumbers
+		return nil
+	})
+	if err != nil {
+		driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=recreating, subscription %d not transferred: %s", cms.deviceName, id, err))
+		return
+	}
+
+	cvs := make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+	for _, seq := range available {
+		err := client.Send(&ua.RepublishRequest{SubscriptionID: id, RetransmitSequenceNumber: seq}, func(v interface{}) error {
+			resp, ok := v.(*ua.RepublishResponse)
+			if !ok || resp.NotificationMessage == nil {
+				return fmt.Errorf("unexpected response %T", v)
+			}
+			for _, data := range resp.NotificationMessage.NotificationData {
+				if data != nil {
+					cvs = cms.handleNotification(data.Value, cvs)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			driver.Logger.Warn(fmt.Sprintf("[Supervisor] device=%s failed to republish sequence %d: %s", cms.deviceName, seq, err))
+		}
+	}
+	if len(cvs) > 0 {
+		sentToAsynCh(cvs, cms.deviceName)
+	}
+	driver.Logger.Info(fmt.Sprintf("[Supervisor] device=%s state=transferred, recovered %d readings of subscription %d", cms.deviceName, len(cvs), id))
+
+	err = client.Send(&ua.DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{id}}, func(v interface{}) error {
+		return nil
+	})
+	if err != nil {
+		driver.Logger.Warn(fmt.Sprintf("[Supervisor] device=%s failed to delete subscription %d: %s", cms.deviceName, id, err))
+	}
+}
+
+// listen sends the readings of the subscription of cms to AsyncCh until ctx is done or the
+// subscription fails.
+func (cms *CMS) listen(ctx context.Context) error {
+	cms.mu.Lock()
+	sub := cms.sub
+	cms.mu.Unlock()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go sub.Run(runCtx)
+
+	cvs := make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+	ticker := time.NewTicker(WaitingDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// cancel fun was called then ctx was done
+			return nil
+		case msg := <-sub.Notifs:
+			if msg.Error != nil {
+				se := &serviceError{service: "Publish", err: msg.Error}
+				if se.broken() {
+					return se
+				}
+				driver.Logger.Warn(fmt.Sprintf("[Supervisor] device=%s %s", cms.deviceName, se))
+				continue
+			}
+			if change, ok := msg.Value.(*ua.StatusChangeNotification); ok {
+				// the server closed the subscription, e.g. its lifetime expired
+				return &serviceError{service: "Publish", err: change.Status}
+			}
+			cvs = cms.handleNotification(msg.Value, cvs)
+			if len(cvs) >= ReadingArrLen {
+				sentToAsynCh(cvs, cms.deviceName)
+				cvs = make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+			}
+		case <-ticker.C:
+			if len(cvs) > 0 {
+				sentToAsynCh(cvs, cms.deviceName)
+				cvs = make([]*sdkModel.CommandValue, 0, ReadingArrLen)
+			}
+			if err := cms.remonitor(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b, err := newBackoff(&DriverConfig{ReconnectMinInterval: "1s", ReconnectMaxInterval: "5s", ReconnectJitter: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if d := b.next(); d != e {
+			t.Errorf("attempt %d: expected %s, got %s", i, e, d)
+		}
+	}
+	b.reset()
+	if d := b.next(); d != time.Second {
+		t.Errorf("expected %s after reset, got %s", time.Second, d)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b, _ := newBackoff(&DriverConfig{ReconnectMinInterval: "1s", ReconnectMaxInterval: "1s", ReconnectJitter: "0.5"})
+	for i := 0; i < 100; i++ {
+		if d := b.next(); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("delay %s out of jitter range", d)
+		}
+	}
+}
+
+func TestBackoffInvalid(t *testing.T) {
+	configs := []*DriverConfig{
+		{ReconnectMinInterval: "x", ReconnectMaxInterval: "1s", ReconnectJitter: "0"},
+		{ReconnectMinInterval: "2s", ReconnectMaxInterval: "1s", ReconnectJitter: "0"},
+		{ReconnectMinInterval: "1s", ReconnectMaxInterval: "2s", ReconnectJitter: "2"},
+	}
+	for _, c := range configs {
+		if _, err := newBackoff(c); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
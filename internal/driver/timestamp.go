@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// timestamp policies, selecting which time of a DataValue becomes the origin of its reading
+const (
+	timestampSource = "source" // SourceTimestamp, when the device sampled the value
+	timestampServer = "server" // ServerTimestamp, when the server received the value
+	timestampLocal  = "local"  // the time the driver received the value
+
+	// timestampAttribute overrides the Timestamp of the device for one device resource
+	timestampAttribute = "timestamp"
+)
+
+// validTimestampPolicy reports an error for values other than source, server and local.
+func validTimestampPolicy(policy string) error {
+	switch policy {
+	case timestampSource, timestampServer, timestampLocal:
+		return nil
+	}
+	return fmt.Errorf("invalid timestamp policy %s, must be %s, %s or %s", policy, timestampSource, timestampServer, timestampLocal)
+}
+
+// timestampPolicy returns the policy of a device resource: its timestamp attribute, or the Timestamp
+// of the device when it has none or an invalid one.
+func timestampPolicy(config *Configuration, attributes map[string]string) string {
+	if policy, ok := attributes[timestampAttribute]; ok && validTimestampPolicy(policy) == nil {
+		return policy
+	}
+	return config.Timestamp
+}
+
+// origin returns the time in nanoseconds of dataValue selected by policy. Servers send the
+// minimum DateTime when they don't know a timestamp, local time is used then.
+func origin(dataValue *ua.DataValue, policy string) int64 {
+	var t time.Time
+	switch policy {
+	case timestampSource:
+		t = dataValue.SourceTimestamp
+	case timestampServer:
+		t = dataValue.ServerTimestamp
+	}
+	if t.IsZero() || t.Year() <= 1601 {
+		return time.Now().UnixNano()
+	}
+	return t.UnixNano()
+}
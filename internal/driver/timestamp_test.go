@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestOrigin(t *testing.T) {
+	source := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	server := source.Add(time.Second)
+	dataValue := &ua.DataValue{SourceTimestamp: source, ServerTimestamp: server}
+
+	if o := origin(dataValue, timestampSource); o != source.UnixNano() {
+		t.Errorf("source: expected %d, got %d", source.UnixNano(), o)
+	}
+	if o := origin(dataValue, timestampServer); o != server.UnixNano() {
+		t.Errorf("server: expected %d, got %d", server.UnixNano(), o)
+	}
+
+	before := time.Now().UnixNano()
+	if o := origin(dataValue, timestampLocal); o < before {
+		t.Errorf("local: expected now, got %d", o)
+	}
+	missing := &ua.DataValue{SourceTimestamp: time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if o := origin(missing, timestampSource); o < before {
+		t.Errorf("missing source timestamp: expected now, got %d", o)
+	}
+}
+
+func TestTimestampPolicy(t *testing.T) {
+	config := &Configuration{Timestamp: timestampServer}
+	tests := []struct {
+		attributes map[string]string
+		expected   string
+	}{
+		{nil, timestampServer},
+		{map[string]string{timestampAttribute: timestampSource}, timestampSource},
+		{map[string]string{timestampAttribute: "plc"}, timestampServer},
+	}
+	for _, test := range tests {
+		if policy := timestampPolicy(config, test.attributes); policy != test.expected {
+			t.Errorf("attributes %v: expected %s, got %s", test.attributes, test.expected, policy)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package driver
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// validateServerCertificate checks the certificate of ep against the trust list of the PKI directory:
+// it must be trusted or issued by a trusted CA, not be revoked by a CRL of trusted/crl or issuers/crl,
+// be valid now, be issued for one of hosts and the ApplicationURI of the server and allow the key usages of
+// an OPC UA application. An untrusted certificate is copied into rejected/certs, so an admin can move
+// it to trusted/certs. Endpoints without security are not checked, their certificate isn't used.
+func (p *pki) validateServerCertificate(ep *ua.EndpointDescription, hosts ...string) error {
+	if ep.SecurityMode == ua.MessageSecurityModeNone {
+		return nil
+	}
+	chain, err := x509.ParseCertificates(ep.ServerCertificate)
+	if err != nil || len(chain) == 0 {
+		return fmt.Errorf("invalid server certificate: %v", err)
+	}
+	cert := chain[0]
+
+	if err := p.verifyTrust(chain); err != nil {
+		if rejectErr := p.reject(cert); rejectErr != nil {
+			return fmt.Errorf("%s, failed to store it in rejected/certs: %s", err, rejectErr)
+		}
+		return fmt.Errorf("%s, stored as %s", err, p.rejectedFile(cert))
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("server certificate is only valid from %s to %s", cert.NotBefore, cert.NotAfter)
+	}
+	if err := verifyHostnames(cert, hosts); err != nil {
+		return fmt.Errorf("server certificate doesn't match host: %s", err)
+	}
+	if ep.Server != nil && certificateURI(cert) != ep.Server.ApplicationURI {
+		return fmt.Errorf("server certificate is issued for ApplicationURI %s, server reports %s",
+			certificateURI(cert), ep.Server.ApplicationURI)
+	}
+	return checkKeyUsage(cert)
+}
+
+// verifyTrust checks that the leaf of chain is in trusted/certs, or is issued by a CA of trusted/certs,
+// optionally through intermediate CAs of the chain or of issuers/certs. No certificate of the path
+// may be revoked.
+func (p *pki) verifyTrust(chain []*x509.Certificate) error {
+	cert := chain[0]
+	trusted := p.loadCertificates("trusted")
+	for _, c := range trusted {
+		if c.Equal(cert) {
+			return p.checkRevocation([]*x509.Certificate{cert})
+		}
+	}
+
+	roots := x509.NewCertPool()
+	for _, c := range trusted {
+		roots.AddCert(c)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	for _, c := range p.loadCertificates("issuers") {
+		intermediates.AddCert(c)
+	}
+	paths, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("server certificate %s is not trusted: %s", cert.Subject.CommonName, err)
+	}
+	return p.checkRevocation(paths[0])
+}
+
+// checkRevocation checks every certificate of path against the CRLs of its issuer.
+func (p *pki) checkRevocation(path []*x509.Certificate) error {
+	crls := append(p.loadCRLs("trusted"), p.loadCRLs("issuers")...)
+	for i, cert := range path {
+		issuer := cert
+		if i+1 < len(path) {
+			issuer = path[i+1]
+		}
+		for _, crl := range crls {
+			if issuer.CheckCRLSignature(crl) != nil {
+				continue // issued by another CA
+			}
+			for _, revoked := range crl.TBSCertList.RevokedCertificates {
+				if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return fmt.Errorf("certificate %s is revoked since %s", cert.Subject.CommonName, revoked.RevocationTime)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyHostnames checks that cert is issued for one of hosts, see certificateHosts.
+func verifyHostnames(cert *x509.Certificate, hosts []string) error {
+	var err error
+	for _, host := range hosts {
+		if err = cert.VerifyHostname(host); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkKeyUsage checks that cert may be used to sign and encrypt a secure channel.
+func checkKeyUsage(cert *x509.Certificate) error {
+	required := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	if cert.KeyUsage != 0 && cert.KeyUsage&required != required {
+		return fmt.Errorf("server certificate key usage %b lacks digitalSignature or keyEncipherment", cert.KeyUsage)
+	}
+	if len(cert.ExtKeyUsage) == 0 {
+		return nil
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth || usage == x509.ExtKeyUsageAny {
+			return nil
+		}
+	}
+	return fmt.Errorf("server certificate extended key usage lacks serverAuth")
+}
+
+// reject copies cert into rejected/certs.
+func (p *pki) reject(cert *x509.Certificate) error {
+	return ioutil.WriteFile(p.rejectedFile(cert), cert.Raw, 0644)
+}
+
+// rejectedFile names a rejected certificate by its SHA-1 thumbprint, as OPC UA tools do.
+func (p *pki) rejectedFile(cert *x509.Certificate) string {
+	return filepath.Join(p.dir, "rejected", "certs", fmt.Sprintf("%X.der", sha1.Sum(cert.Raw)))
+}
+
+// loadCertificates reads the certificates in the certs folder of a PKI sub directory, unreadable files are skipped.
+func (p *pki) loadCertificates(dir string) []*x509.Certificate {
+	path := filepath.Join(p.dir, dir, "certs")
+	files, _ := ioutil.ReadDir(path)
+	certs := make([]*x509.Certificate, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		der, err := loadCertificate(filepath.Join(path, f.Name()))
+		if err != nil {
+			continue
+		}
+		if c, err := x509.ParseCertificate(der); err == nil {
+			certs = append(certs, c)
+		}
+	}
+	return certs
+}
+
+// loadCRLs reads the PEM or DER encoded revocation lists in the crl folder of a PKI sub directory.
+func (p *pki) loadCRLs(dir string) []*pkix.CertificateList {
+	path := filepath.Join(p.dir, dir, "crl")
+	files, _ := ioutil.ReadDir(path)
+	crls := make([]*pkix.CertificateList, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(path, f.Name()))
+		if err != nil {
+			continue
+		}
+		if crl, err := x509.ParseCRL(b); err == nil {
+			crls = append(crls, crl)
+		}
+	}
+	return crls
+}
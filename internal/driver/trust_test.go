@@ -0,0 +1,61 @@
+package driver
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestValidateServerCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a generated application certificate serves as server certificate
+	server, _ := newPKI(filepath.Join(dir, "server"), "urn:test:server")
+	if err := server.generateOwnCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	der, _ := loadCertificate(server.ownCertFile())
+	cert, _ := x509.ParseCertificate(der)
+	ep := &ua.EndpointDescription{
+		SecurityMode:      ua.MessageSecurityModeSignAndEncrypt,
+		ServerCertificate: der,
+		Server:            &ua.ApplicationDescription{ApplicationURI: "urn:test:server"},
+	}
+	if len(cert.DNSNames) == 0 {
+		t.Skip("no hostname to issue the certificate for")
+	}
+	host := cert.DNSNames[0]
+
+	client, _ := newPKI(filepath.Join(dir, "client"), "urn:test:client")
+	if err := client.validateServerCertificate(ep, host); err == nil {
+		t.Fatal("untrusted certificate accepted")
+	}
+	rejected := client.rejectedFile(cert)
+	if _, err := os.Stat(rejected); err != nil {
+		t.Fatalf("untrusted certificate not stored in rejected/certs: %s", err)
+	}
+
+	// promote the rejected certificate
+	if err := os.Rename(rejected, filepath.Join(client.dir, "trusted", "certs", filepath.Base(rejected))); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.validateServerCertificate(ep, host); err != nil {
+		t.Fatalf("trusted certificate rejected: %s", err)
+	}
+
+	if err := client.validateServerCertificate(ep, "other.example.com"); err == nil {
+		t.Error("certificate of another host accepted")
+	}
+	ep.Server.ApplicationURI = "urn:test:other"
+	if err := client.validateServerCertificate(ep, host); err == nil {
+		t.Error("certificate of another ApplicationURI accepted")
+	}
+}